@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultBlueskyPDS is the PDS Bluesky accounts are hosted on by default.
+const DefaultBlueskyPDS = "https://bsky.social"
+
+// BlueskyMaxGraphemes is the longest a post's text may be, in graphemes.
+const BlueskyMaxGraphemes = 300
+
+// blueskyLinkLength is the length links are cut to when a post is too long.
+const blueskyLinkLength = 32
+
+var (
+	// facetLink matches the links in a post.
+	facetLink = regexp.MustCompile(`https?://[^\s]+`)
+
+	// facetTag matches the hashtags in a post, capturing the tag.
+	facetTag = regexp.MustCompile(`(?:^|\s)(#([\p{L}\p{N}_]*[\p{L}_][\p{L}\p{N}_]*))`)
+)
+
+// BlueskyPublisher posts to Bluesky, or any other AT Protocol service,
+// through the account's PDS. Sessions are created on first use and again
+// whenever the access token expires.
+type BlueskyPublisher struct {
+	// PDSURL is the base URL of the account's PDS.
+	PDSURL     string
+	Identifier string
+	Password   string
+
+	// Language is the BCP 47 language of posts. It may be empty.
+	Language string
+
+	client *http.Client
+
+	mu      sync.Mutex
+	session *blueskySession
+}
+
+type blueskySession struct {
+	AccessJwt string `json:"accessJwt"`
+	DID       string `json:"did"`
+	Handle    string `json:"handle"`
+}
+
+// NewBlueskyPublisher returns a BlueskyPublisher logging in to the PDS at
+// pdsURL with the identifier, a handle or DID, and an app password.
+func NewBlueskyPublisher(pdsURL, identifier, password, language string) *BlueskyPublisher {
+	return &BlueskyPublisher{
+		PDSURL:     strings.TrimRight(pdsURL, "/"),
+		Identifier: identifier,
+		Password:   password,
+		Language:   language,
+		client:     &http.Client{},
+	}
+}
+
+func (b *BlueskyPublisher) Name() string {
+	return "bluesky"
+}
+
+// BlueskyError is an error response from an XRPC endpoint.
+type BlueskyError struct {
+	Procedure string
+	Status    int
+	Code      string `json:"error"`
+	Message   string `json:"message"`
+}
+
+func (e *BlueskyError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s: %d %s: %s", e.Procedure, e.Status, e.Code, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %d %s", e.Procedure, e.Status, e.Code)
+}
+
+// expired returns true if err means the session must be created again.
+func expired(err error) bool {
+	var e *BlueskyError
+	return errors.As(err, &e) && (e.Status == http.StatusUnauthorized || e.Code == "ExpiredToken" || e.Code == "InvalidToken")
+}
+
+// xrpc calls the procedure with body as JSON and decodes the response into
+// out. A non-empty token is sent as the bearer token.
+func (b *BlueskyPublisher) xrpc(ctx context.Context, procedure, token string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", b.PDSURL+"/xrpc/"+procedure, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err = ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &BlueskyError{Procedure: procedure, Status: resp.StatusCode}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Code == "" {
+			apiErr.Code = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// login returns the current session, creating one if there is none or
+// renew is set.
+func (b *BlueskyPublisher) login(ctx context.Context, renew bool) (*blueskySession, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.session != nil && !renew {
+		return b.session, nil
+	}
+
+	session := &blueskySession{}
+	err := b.xrpc(ctx, "com.atproto.server.createSession", "", map[string]string{
+		"identifier": b.Identifier,
+		"password":   b.Password,
+	}, session)
+	if err != nil {
+		return nil, err
+	}
+	b.session = session
+
+	return session, nil
+}
+
+// Facet marks a byte range of a post's text as a link or hashtag.
+type Facet struct {
+	Index    FacetIndex     `json:"index"`
+	Features []FacetFeature `json:"features"`
+}
+
+// FacetIndex is a range of a post's UTF-8 encoded text, ByteEnd exclusive.
+type FacetIndex struct {
+	ByteStart int `json:"byteStart"`
+	ByteEnd   int `json:"byteEnd"`
+}
+
+// FacetFeature is a link to URI or a hashtag Tag, without the "#".
+type FacetFeature struct {
+	Type string `json:"$type"`
+	URI  string `json:"uri,omitempty"`
+	Tag  string `json:"tag,omitempty"`
+}
+
+// Facets returns the link and hashtag facets of text.
+func Facets(text string) []Facet {
+	var facets []Facet
+	for _, m := range facetLink.FindAllStringIndex(text, -1) {
+		uri := strings.TrimRight(text[m[0]:m[1]], ".,;:!?)")
+		facets = append(facets, Facet{
+			Index:    FacetIndex{m[0], m[0] + len(uri)},
+			Features: []FacetFeature{{Type: "app.bsky.richtext.facet#link", URI: uri}},
+		})
+	}
+	for _, m := range facetTag.FindAllStringSubmatchIndex(text, -1) {
+		facets = append(facets, Facet{
+			Index:    FacetIndex{m[2], m[3]},
+			Features: []FacetFeature{{Type: "app.bsky.richtext.facet#tag", Tag: text[m[4]:m[5]]}},
+		})
+	}
+
+	return facets
+}
+
+// Graphemes returns the number of user-perceived characters in s. Combining
+// marks, variation selectors and characters joined by a zero width joiner
+// do not count as characters of their own.
+func Graphemes(s string) int {
+	n := 0
+	joined := false
+	for _, r := range s {
+		switch {
+		case r == '\u200d':
+			joined = true
+			continue
+		case joined:
+		case unicode.In(r, unicode.Mn, unicode.Me) || (r >= '\ufe00' && r <= '\ufe0f'):
+		default:
+			n++
+		}
+		joined = false
+	}
+
+	return n
+}
+
+// cutGraphemes returns s cut to at most n graphemes, the last of them an
+// ellipsis if it was cut.
+func cutGraphemes(s string, n int) string {
+	if Graphemes(s) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+
+	for i, r := range s {
+		if Graphemes(s[:i+utf8.RuneLen(r)]) > n-1 {
+			return strings.TrimRightFunc(s[:i], unicode.IsSpace) + "…"
+		}
+	}
+
+	return s
+}
+
+// richText is a post's text with its facets.
+type richText struct {
+	text   strings.Builder
+	facets []Facet
+}
+
+func (r *richText) write(s string) {
+	r.text.WriteString(s)
+}
+
+// link writes display, a facet linking it to uri.
+func (r *richText) link(display, uri string) {
+	start := r.text.Len()
+	r.text.WriteString(display)
+	r.facets = append(r.facets, Facet{
+		Index:    FacetIndex{start, r.text.Len()},
+		Features: []FacetFeature{{Type: "app.bsky.richtext.facet#link", URI: uri}},
+	})
+}
+
+// tag writes the hashtag "#tag" with its facet.
+func (r *richText) tag(tag string) {
+	start := r.text.Len()
+	r.text.WriteString("#" + tag)
+	r.facets = append(r.facets, Facet{
+		Index:    FacetIndex{start, r.text.Len()},
+		Features: []FacetFeature{{Type: "app.bsky.richtext.facet#tag", Tag: tag}},
+	})
+}
+
+// shortLink returns uri without its scheme and cut to blueskyLinkLength,
+// for display.
+func shortLink(uri string) string {
+	display := strings.TrimPrefix(strings.TrimPrefix(uri, "https://"), "http://")
+	display = strings.TrimPrefix(display, "www.")
+
+	return cutGraphemes(display, blueskyLinkLength)
+}
+
+// paperText lays paper out like NewPost, with the paper's name cut to name
+// graphemes, links shortened if short is set and hashtags only if tags is
+// set.
+func paperText(paper *Paper, name int, short, tags bool) *richText {
+	display := func(uri string) string {
+		if short {
+			return shortLink(uri)
+		}
+		return uri
+	}
+
+	r := &richText{}
+	r.write(fmt.Sprintf("%s (%s)\n", cutGraphemes(paper.Name, name), paper.Kind))
+	r.link(display(paper.URL), paper.URL)
+	if paper.Mirror != "" {
+		r.write("\nMirror: ")
+		r.link(display(paper.Mirror), paper.Mirror)
+	}
+	if hashtags := paper.Hashtags(); tags && len(hashtags) > 0 {
+		r.write("\n")
+		for i, tag := range hashtags {
+			if i > 0 {
+				r.write(" ")
+			}
+			r.tag(tag)
+		}
+	}
+
+	return r
+}
+
+// BlueskyText returns the text of post and its facets, shortened to fit in
+// BlueskyMaxGraphemes. The links of a post that is too long are shown cut
+// short, their facets still linking the whole links, then the paper's name
+// is cut, then its hashtags dropped. As a last resort the text is cut.
+func BlueskyText(post Post) (string, []Facet) {
+	if Graphemes(post.Text) <= BlueskyMaxGraphemes || post.Paper == nil {
+		text := cutGraphemes(post.Text, BlueskyMaxGraphemes)
+		return text, Facets(text)
+	}
+
+	paper := post.Paper
+	var r *richText
+	for _, tags := range []bool{true, false} {
+		r = paperText(paper, Graphemes(paper.Name), true, tags)
+		over := Graphemes(r.text.String()) - BlueskyMaxGraphemes
+		if over <= 0 {
+			return r.text.String(), r.facets
+		}
+		if name := Graphemes(paper.Name) - over; name >= blueskyLinkLength {
+			r = paperText(paper, name, true, tags)
+			return r.text.String(), r.facets
+		}
+	}
+
+	text := cutGraphemes(r.text.String(), BlueskyMaxGraphemes)
+	var facets []Facet
+	for _, facet := range r.facets {
+		if facet.Index.ByteEnd <= len(text)-len("…") {
+			facets = append(facets, facet)
+		}
+	}
+
+	return text, facets
+}
+
+// blueskyPost is an app.bsky.feed.post record.
+type blueskyPost struct {
+	Type      string        `json:"$type"`
+	Text      string        `json:"text"`
+	CreatedAt string        `json:"createdAt"`
+	Facets    []Facet       `json:"facets,omitempty"`
+	Langs     []string      `json:"langs,omitempty"`
+	Embed     *blueskyEmbed `json:"embed,omitempty"`
+}
+
+// blueskyEmbed is an app.bsky.embed.external link card.
+type blueskyEmbed struct {
+	Type     string `json:"$type"`
+	External struct {
+		URI         string `json:"uri"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	} `json:"external"`
+}
+
+// Publish posts the text, shortened to fit, with its links and hashtags
+// marked up and a link card for the paper.
+func (b *BlueskyPublisher) Publish(ctx context.Context, post Post) (*Published, error) {
+	text, facets := BlueskyText(post)
+	record := &blueskyPost{
+		Type:      "app.bsky.feed.post",
+		Text:      text,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Facets:    facets,
+	}
+	if b.Language != "" {
+		record.Langs = []string{b.Language}
+	}
+	if post.Paper != nil {
+		embed := &blueskyEmbed{Type: "app.bsky.embed.external"}
+		embed.External.URI = post.Paper.URL
+		embed.External.Title = post.Paper.Name
+		embed.External.Description = PaperByline(post.Paper)
+		record.Embed = embed
+	}
+
+	session, err := b.login(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var created struct {
+		URI string `json:"uri"`
+		CID string `json:"cid"`
+	}
+	create := func(session *blueskySession) error {
+		return b.xrpc(ctx, "com.atproto.repo.createRecord", session.AccessJwt, map[string]interface{}{
+			"repo":       session.DID,
+			"collection": "app.bsky.feed.post",
+			"record":     record,
+		}, &created)
+	}
+
+	err = create(session)
+	if expired(err) {
+		if session, err = b.login(ctx, true); err != nil {
+			return nil, err
+		}
+		err = create(session)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rkey := created.URI[strings.LastIndex(created.URI, "/")+1:]
+
+	return &Published{
+		ID:  created.URI,
+		URL: fmt.Sprintf("https://bsky.app/profile/%s/post/%s", session.Handle, rkey),
+	}, nil
+}
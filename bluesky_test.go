@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkFacets checks that every facet of text covers the hashtag or the
+// display text of the link it marks up.
+func checkFacets(t *testing.T, text string, facets []Facet) {
+	for _, facet := range facets {
+		if facet.Index.ByteStart < 0 || facet.Index.ByteEnd > len(text) || facet.Index.ByteStart >= facet.Index.ByteEnd {
+			t.Errorf("facet %+v out of range of %q", facet.Index, text)
+			continue
+		}
+		covered := text[facet.Index.ByteStart:facet.Index.ByteEnd]
+		feature := facet.Features[0]
+		switch {
+		case feature.Tag != "":
+			if covered != "#"+feature.Tag {
+				t.Errorf("tag facet covers %q, want %q", covered, "#"+feature.Tag)
+			}
+		case strings.HasSuffix(covered, "…"):
+			shown := strings.TrimSuffix(covered, "…")
+			if !strings.Contains(feature.URI, shown) {
+				t.Errorf("link facet covers %q, not part of %q", covered, feature.URI)
+			}
+		default:
+			if !strings.Contains(feature.URI, covered) {
+				t.Errorf("link facet covers %q, not part of %q", covered, feature.URI)
+			}
+		}
+	}
+}
+
+func TestBlueskyText(t *testing.T) {
+	long := strings.Repeat("Ünïcödé Consensus ", 30)
+	tests := []struct {
+		name  string
+		paper *Paper
+	}{
+		{"short", &Paper{
+			Name:  "Paxos Made Simple",
+			URL:   "https://lamport.azurewebsites.net/pubs/paxos-simple.pdf",
+			Kind:  KindPDF,
+			Topic: "distributed_systems",
+		}},
+		{"long name", &Paper{
+			Name:     long,
+			URL:      "https://example.org/" + strings.Repeat("path/", 40) + "paper.pdf",
+			Mirror:   "https://github.com/papers-we-love/papers-we-love/blob/master/distributed_systems/paper.pdf",
+			Form:     FormBoth,
+			Kind:     KindPDF,
+			Topic:    "distributed_systems/consensus",
+			Subtopic: "Paxos",
+		}},
+		{"long links", &Paper{
+			Name:   "Raft",
+			URL:    "https://example.org/" + strings.Repeat("a", 400) + ".pdf",
+			Mirror: "https://example.org/" + strings.Repeat("b", 400) + ".pdf",
+			Kind:   KindPDF,
+			Topic:  "distributed_systems",
+		}},
+		{"long topic", &Paper{
+			Name:     "Raft",
+			URL:      "https://example.org/raft.pdf",
+			Kind:     KindPDF,
+			Topic:    strings.Repeat("topic_", 60),
+			Subtopic: strings.Repeat("sub_", 60),
+		}},
+	}
+
+	for _, test := range tests {
+		post := NewPost(test.paper)
+		text, facets := BlueskyText(post)
+		if n := Graphemes(text); n > BlueskyMaxGraphemes {
+			t.Errorf("%s: text is %d graphemes long, want at most %d", test.name, n, BlueskyMaxGraphemes)
+		}
+		if Graphemes(post.Text) <= BlueskyMaxGraphemes && text != post.Text {
+			t.Errorf("%s: text = %q, want it unchanged", test.name, text)
+		}
+		if !strings.Contains(text, "("+string(test.paper.Kind)+")") {
+			t.Errorf("%s: text %q lost the paper kind", test.name, text)
+		}
+		checkFacets(t, text, facets)
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"abc", 3},
+		{"é", 1},
+		{"👨‍👩‍👧", 1},
+		{"❤️", 1},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := Graphemes(test.s); got != test.want {
+			t.Errorf("Graphemes(%q) = %d, want %d", test.s, got, test.want)
+		}
+	}
+	if got := cutGraphemes("abcdef", 4); got != "abc…" {
+		t.Errorf("cutGraphemes = %q, want %q", got, "abc…")
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/imwally/love-a-paper/mdlinks"
+)
+
+// Paper is a link to a paper found in one of the repository's README files.
+type Paper struct {
+	Name       string
+	URL        string
+	Kind       PaperKind
+	Topic      string
+	Subtopic   string
+	ReadmePath string
+
+	// Form is which of the entry's links the paper is posted with. Mirror
+	// is only set in FormBoth, where URL is the primary link.
+	Form   LinkForm
+	Mirror string
+
+	// Permalink points at the line of the README the paper was linked
+	// from.
+	Permalink string
+
+	// Annotations are signalled by markers next to the paper's link, such
+	// as PWL's scroll for papers hosted in the repository.
+	Annotations []mdlinks.Annotation
+
+	// Authors and Year are only known once the paper's metadata is read.
+	Authors []string
+	Year    int
+	Sources FieldSources
+}
+
+// Catalog is an in-memory index of every paper entry found in a
+// repository.
+type Catalog struct {
+	Entries []PaperEntry
+	Updated time.Time
+}
+
+// paperLinks extracts every kind of link that can point to a paper, which is
+// any kind but images.
+var paperLinks = mdlinks.NewExtractor(mdlinks.Inline, mdlinks.Reference, mdlinks.AutoLink, mdlinks.HTML)
+
+// Indexer builds a Catalog of papers from a PaperSource. Every README.md
+// listed by the source is parsed for paper links. Links are resolved against
+// the README's location on Github, whatever the source.
+//
+// A build stops reading READMEs once the API call budget is spent or the
+// rate limit is hit; papers from READMEs it did not get to are carried over
+// from earlier builds. READMEs that repeatedly yield no papers are
+// remembered as dead ends and skipped for the rest of the run.
+type Indexer struct {
+	Owner    string
+	Repo     string
+	Ref      string
+	Interval time.Duration
+	Budget   SearchBudget
+
+	// Classifier decides which links are papers.
+	Classifier *Classifier
+
+	// Resolver turns README links into the URLs that are posted.
+	Resolver *Resolver
+
+	// SkipSections are README section headings whose links are ignored.
+	// They are matched case insensitively against every enclosing heading.
+	SkipSections []string
+
+	// MaxDepth limits how deeply nested the topic directories READMEs are
+	// read from may be. Zero means no limit.
+	MaxDepth int
+
+	// Markers annotates the links read from READMEs. If nil, the
+	// mdlinks.DefaultMarkers are used.
+	Markers *mdlinks.MarkerRegistry
+
+	source PaperSource
+
+	mu      sync.Mutex
+	catalog *Catalog
+	entries map[string][]PaperEntry
+	misses  map[string]int
+}
+
+// NewIndexer returns an Indexer reading READMEs from source, a copy of the
+// repository owner/repo at ref. The catalog is rebuilt once it is older than
+// interval.
+func NewIndexer(source PaperSource, owner, repo, ref string, interval time.Duration, budget SearchBudget) *Indexer {
+	return &Indexer{
+		Owner:      owner,
+		Repo:       repo,
+		Ref:        ref,
+		Interval:   interval,
+		Budget:     budget,
+		Classifier: DefaultClassifier,
+		Resolver:   DefaultResolver,
+		source:     source,
+		entries:    make(map[string][]PaperEntry),
+		misses:     make(map[string]int),
+	}
+}
+
+// Catalog returns the current catalog, rebuilding it first if it has never
+// been built or is older than the refresh interval. If a rebuild fails and a
+// previous catalog exists, the stale catalog is returned instead.
+func (ix *Indexer) Catalog() (*Catalog, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.catalog != nil && time.Since(ix.catalog.Updated) < ix.Interval {
+		return ix.catalog, nil
+	}
+
+	return ix.build()
+}
+
+// Build rebuilds the catalog regardless of its age.
+func (ix *Indexer) Build() (*Catalog, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.build()
+}
+
+// Miss records that none of the papers from the README at readmePath could
+// be posted. The README becomes a dead end once it has missed DeadEndAfter
+// times in a row.
+func (ix *Indexer) Miss(readmePath string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.misses[readmePath]++
+	if ix.misses[readmePath] == DeadEndAfter {
+		log.Printf("INFO: %s is a dead end", readmePath)
+	}
+}
+
+// Hit records that a paper from the README at readmePath was found, which
+// resets its count of misses.
+func (ix *Indexer) Hit(readmePath string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.misses[readmePath] = 0
+}
+
+// IsDeadEnd returns true if the README at readmePath has been given up on.
+func (ix *Indexer) IsDeadEnd(readmePath string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.misses[readmePath] >= DeadEndAfter
+}
+
+// build reads the READMEs listed by the source, never read READMEs first.
+// Only a GithubSource spends an API request on every README it reads, so
+// only its reads are counted against the API call budget; other sources
+// read every README they list. Sources that spend Github API requests have
+// their budget capped to the requests remaining before the build starts. It
+// must be called with ix.mu held.
+func (ix *Indexer) build() (*Catalog, error) {
+	log.Printf("INFO: indexing %s/%s@%s", ix.Owner, ix.Repo, ix.Ref)
+	budget := ix.Budget.APICalls
+	if src, ok := ix.source.(RateLimitedSource); ok {
+		rate, err := src.Rate()
+		if err != nil {
+			return ix.fallback(err)
+		}
+		if rate.Remaining < MinAPICalls {
+			return ix.fallback(RateLimitedError(rate))
+		}
+		if rate.Remaining < budget {
+			budget = rate.Remaining
+		}
+	}
+
+	_, metered := ix.source.(*GithubSource)
+	calls := 1
+	readmes, err := ix.source.Readmes()
+	if err != nil {
+		if IsRateLimit(err) {
+			return ix.fallback(&SearchError{Reason: RateLimited, Err: err})
+		}
+		return ix.fallback(err)
+	}
+
+	var unread, read []string
+	for _, readme := range readmes {
+		if !IsReadme(readme) || ix.misses[readme] >= DeadEndAfter {
+			continue
+		}
+		if ix.MaxDepth > 0 && ReadmeDepth(readme) > ix.MaxDepth {
+			continue
+		}
+		if _, ok := ix.entries[readme]; ok {
+			read = append(read, readme)
+		} else {
+			unread = append(unread, readme)
+		}
+	}
+	Shuffle(unread)
+	Shuffle(read)
+
+	var stopped error
+	for _, readme := range append(unread, read...) {
+		if metered {
+			if calls >= budget {
+				stopped = &SearchError{Reason: BudgetExhausted}
+				break
+			}
+			calls++
+		}
+
+		entries, err := ix.readmeEntries(readme)
+		if IsRateLimit(err) {
+			stopped = &SearchError{Reason: RateLimited, Err: err}
+			break
+		}
+		if err != nil {
+			log.Printf("FAILED: %s: %s", readme, err)
+			ix.misses[readme]++
+			continue
+		}
+		if len(entries) == 0 {
+			ix.misses[readme]++
+			delete(ix.entries, readme)
+			continue
+		}
+
+		ix.misses[readme] = 0
+		ix.entries[readme] = entries
+	}
+	if stopped != nil {
+		log.Printf("INFO: indexing stopped after %d requests: %s", calls, stopped)
+	}
+
+	catalog := &Catalog{Updated: time.Now()}
+	for readme, entries := range ix.entries {
+		if ix.misses[readme] >= DeadEndAfter {
+			continue
+		}
+		catalog.Entries = append(catalog.Entries, entries...)
+	}
+	log.Printf("INFO: indexed %d papers", len(catalog.Entries))
+
+	if len(catalog.Entries) == 0 {
+		if stopped == nil {
+			stopped = &SearchError{Reason: NoCandidates}
+		}
+		return ix.fallback(stopped)
+	}
+	ix.catalog = catalog
+
+	return catalog, nil
+}
+
+// fallback returns the previous catalog when a rebuild fails with err, or
+// err if there is no previous catalog.
+func (ix *Indexer) fallback(err error) (*Catalog, error) {
+	if ix.catalog == nil {
+		return nil, err
+	}
+	log.Printf("FAILED: rebuilding catalog: %s, using catalog from %s", err, ix.catalog.Updated)
+
+	return ix.catalog, nil
+}
+
+// readmeEntries reads the README at readmePath and returns every paper
+// entry listed in it.
+func (ix *Indexer) readmeEntries(readmePath string) ([]PaperEntry, error) {
+	content, err := ix.source.ReadReadme(readmePath)
+	if err != nil {
+		return nil, err
+	}
+
+	readmeURL, err := url.Parse(fmt.Sprintf("https://github.com/%s/%s/blob/%s/%s", ix.Owner, ix.Repo, ix.Ref, readmePath))
+	if err != nil {
+		return nil, err
+	}
+
+	extractor := *paperLinks
+	if ix.Markers != nil {
+		extractor.Markers = ix.Markers
+	}
+
+	return ix.itemEntries(readmeURL, readmePath, extractor.Items(content)), nil
+}
+
+// LinkName returns the name of links[i]. Links named by nothing but a
+// marker, like PWL's "[:scroll:](paper.pdf) [Name](...)", take the name of
+// the next named link on the same line, or failing that the file name of
+// location.
+func LinkName(links []mdlinks.Link, i int, location string) string {
+	link := links[i]
+	if link.Name != "" {
+		return link.Name
+	}
+
+	for _, next := range links[i+1:] {
+		if next.Line != link.Line {
+			break
+		}
+		if next.Name != "" {
+			return next.Name
+		}
+	}
+
+	name := path.Base(location)
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+
+	return name
+}
+
+// Permalink returns the URL of line of the README at readmePath on Github.
+// Plain view is requested so the line anchor works. A zero line links to
+// the README itself.
+func (ix *Indexer) Permalink(readmePath string, line int) string {
+	permalink := fmt.Sprintf("https://github.com/%s/%s/blob/%s/%s", ix.Owner, ix.Repo, ix.Ref, readmePath)
+	if line > 0 {
+		permalink += fmt.Sprintf("?plain=1#L%d", line)
+	}
+
+	return permalink
+}
+
+// skipped returns true if any of headings is one of the sections to skip.
+func (ix *Indexer) skipped(headings []mdlinks.Heading) bool {
+	for _, heading := range headings {
+		for _, skip := range ix.SkipSections {
+			if strings.EqualFold(heading.Text, skip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Subtopic returns a hashtag friendly name for the innermost section below
+// the README's title, or an empty string if the link is not in one.
+func Subtopic(headings []mdlinks.Heading) string {
+	for i := len(headings) - 1; i >= 0; i-- {
+		if headings[i].Level > 1 {
+			return Hashtag(headings[i].Text)
+		}
+	}
+
+	return ""
+}
+
+// Hashtag turns text into a hashtag, without the leading "#". Each word is
+// capitalized and anything but letters and digits is dropped.
+func Hashtag(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return strings.Join(strings.Fields(strings.Title(strings.Join(words, " "))), "")
+}
+
+// Hashtags returns the hashtags for each part of the paper's topic and its
+// subtopic, without the leading "#".
+func (p *Paper) Hashtags() []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range append(strings.Split(p.Topic, "/"), p.Subtopic) {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// IsReadme returns true if p is the path of a README.md file that lives in a
+// topic directory. The repository's top level README and anything below a
+// directory starting with "." or "_" is ignored.
+func IsReadme(p string) bool {
+	if path.Base(p) != "README.md" {
+		return false
+	}
+
+	dir := path.Dir(p)
+	if dir == "." {
+		return false
+	}
+
+	for _, part := range strings.Split(dir, "/") {
+		if HasPrefix(part, []string{".", "_"}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// TopicName turns a repository directory into a hashtag friendly topic name.
+// Hyphens and underscores are treated as word separators, each word is
+// capitalized and the spaces are then removed. The names of nested
+// directories are joined by "/", so distributed_systems/consensus becomes
+// DistributedSystems/Consensus.
+func TopicName(dir string) string {
+	re := regexp.MustCompile(`(-|_)`)
+
+	var names []string
+	for _, part := range strings.Split(path.Clean(dir), "/") {
+		// Replace hyphens and underscores with spaces
+		topic := re.ReplaceAllString(part, " ")
+
+		// Capitalize topic words then strip spaces
+		names = append(names, strings.Replace(strings.Title(topic), " ", "", -1))
+	}
+
+	return strings.Join(names, "/")
+}
+
+// ReadmeDepth returns how deeply the README at p is nested below the
+// repository root: 1 for a README in a top level topic directory.
+func ReadmeDepth(p string) int {
+	dir := path.Dir(p)
+	if dir == "." {
+		return 0
+	}
+
+	return strings.Count(dir, "/") + 1
+}
+
+// RandomEntry returns a random PaperEntry from the catalog for which skip
+// returns false. A nil skip accepts every entry.
+func (c *Catalog) RandomEntry(skip func(*PaperEntry) bool) (*PaperEntry, error) {
+	var candidates []int
+	for i := range c.Entries {
+		if skip == nil || !skip(&c.Entries[i]) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, &SearchError{Reason: NoCandidates}
+	}
+
+	randInt, err := RandomInt(len(candidates))
+	if err != nil {
+		return nil, err
+	}
+	entry := c.Entries[candidates[randInt]]
+
+	return &entry, nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// budgetTopics are the topics of the READMEs the budget tests index, each
+// listing a single paper.
+var budgetTopics = []string{"consensus", "databases", "networking", "storage", "type_theory"}
+
+func budgetReadme(topic string) string {
+	return fmt.Sprintf("# %s\n\n* [A %s paper](https://example.org/%s.pdf)\n", topic, topic, topic)
+}
+
+func TestIndexerBudgetLocalSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, topic := range budgetTopics {
+		if err := os.MkdirAll(filepath.Join(dir, topic), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, topic, "README.md"), []byte(budgetReadme(topic)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ix := NewIndexer(NewLocalSource(dir), "papers-we-love", "papers-we-love", "master", time.Hour, SearchBudget{APICalls: 2})
+	catalog, err := ix.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Entries) != len(budgetTopics) {
+		t.Errorf("indexed %d papers, want all %d", len(catalog.Entries), len(budgetTopics))
+	}
+}
+
+func TestIndexerBudgetGithubSource(t *testing.T) {
+	var tree []string
+	for _, topic := range budgetTopics {
+		tree = append(tree, fmt.Sprintf(`{"path": "%s/README.md", "type": "blob", "sha": "%s"}`, topic, topic))
+	}
+	blobs := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/rate_limit":
+			fmt.Fprint(w, `{"resources": {"core": {"limit": 5000, "remaining": 5000}}}`)
+		case strings.HasPrefix(r.URL.Path, "/repos/papers-we-love/papers-we-love/git/trees/"):
+			fmt.Fprintf(w, `{"sha": "master", "tree": [%s]}`, strings.Join(tree, ","))
+		case strings.HasPrefix(r.URL.Path, "/repos/papers-we-love/papers-we-love/git/blobs/"):
+			blobs++
+			topic := strings.TrimPrefix(r.URL.Path, "/repos/papers-we-love/papers-we-love/git/blobs/")
+			content := base64.StdEncoding.EncodeToString([]byte(budgetReadme(topic)))
+			fmt.Fprintf(w, `{"content": %q, "encoding": "base64"}`, content)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	client := newTestGithubClient(t, &Config{}, handler, nil)
+
+	source := NewGithubSource(client, "papers-we-love", "papers-we-love", "master")
+	ix := NewIndexer(source, "papers-we-love", "papers-we-love", "master", time.Hour, SearchBudget{APICalls: 3})
+	catalog, err := ix.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobs != 2 || len(catalog.Entries) != 2 {
+		t.Errorf("read %d READMEs and indexed %d papers, want 2 of each with a budget of 3 requests", blobs, len(catalog.Entries))
+	}
+}
+
+// writeReadme writes the README of topic in the checkout at dir.
+func writeReadme(t *testing.T, dir, topic, content string) {
+	if err := os.MkdirAll(filepath.Join(dir, topic), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, topic, "README.md"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// catalogURLs returns the URLs of the entries of catalog, sorted.
+func catalogURLs(catalog *Catalog) []string {
+	var urls []string
+	for _, entry := range catalog.Entries {
+		urls = append(urls, entry.URL)
+	}
+	sort.Strings(urls)
+
+	return urls
+}
+
+func TestIndexerCatalog(t *testing.T) {
+	dir := t.TempDir()
+	writeReadme(t, dir, "consensus", budgetReadme("consensus"))
+	writeReadme(t, dir, "databases", budgetReadme("databases"))
+	ix := NewIndexer(NewLocalSource(dir), "papers-we-love", "papers-we-love", "master", time.Hour, SearchBudget{APICalls: 10})
+
+	catalog, err := ix.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.org/consensus.pdf", "https://example.org/databases.pdf"}
+	if got := catalogURLs(catalog); !reflect.DeepEqual(got, want) {
+		t.Errorf("built catalog of %q, want %q", got, want)
+	}
+
+	// Within the refresh interval the catalog is not rebuilt.
+	writeReadme(t, dir, "storage", budgetReadme("storage"))
+	cached, err := ix.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != catalog {
+		t.Errorf("catalog rebuilt before the refresh interval")
+	}
+
+	// Once the interval has passed, new READMEs are read, papers from
+	// READMEs that can no longer be read are carried over and READMEs
+	// without papers are dropped.
+	readme := filepath.Join(dir, "consensus", "README.md")
+	if err := os.Remove(readme); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing.md"), readme); err != nil {
+		t.Fatal(err)
+	}
+	writeReadme(t, dir, "databases", "# databases\n\nNothing here yet.\n")
+	catalog.Updated = time.Now().Add(-2 * time.Hour)
+
+	refreshed, err := ix.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed == catalog {
+		t.Fatal("catalog not rebuilt after the refresh interval")
+	}
+	want = []string{"https://example.org/consensus.pdf", "https://example.org/storage.pdf"}
+	if got := catalogURLs(refreshed); !reflect.DeepEqual(got, want) {
+		t.Errorf("refreshed catalog of %q, want %q", got, want)
+	}
+}
+
+func TestCatalogRandomEntry(t *testing.T) {
+	catalog := &Catalog{}
+	for _, topic := range budgetTopics {
+		catalog.Entries = append(catalog.Entries, PaperEntry{Topic: topic, URL: "https://example.org/" + topic + ".pdf"})
+	}
+
+	skip := func(entry *PaperEntry) bool {
+		return entry.Topic != "storage"
+	}
+	for i := 0; i < 20; i++ {
+		entry, err := catalog.RandomEntry(skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Topic != "storage" {
+			t.Fatalf("RandomEntry() = %s, want the only entry not skipped", entry.Topic)
+		}
+	}
+
+	_, err := catalog.RandomEntry(func(*PaperEntry) bool { return true })
+	if e, ok := err.(*SearchError); !ok || e.Reason != NoCandidates {
+		t.Errorf("RandomEntry() with every entry skipped = %v, want no candidates", err)
+	}
+}
+
+func TestTopicName(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"distributed_systems", "DistributedSystems"},
+		{"machine-learning", "MachineLearning"},
+		{"distributed_systems/consensus", "DistributedSystems/Consensus"},
+		{"languages-paradigms/functional_programming/type-theory", "LanguagesParadigms/FunctionalProgramming/TypeTheory"},
+		{"datastores/", "Datastores"},
+		{"./datastores//key_value", "Datastores/KeyValue"},
+	}
+
+	for _, test := range tests {
+		if got := TopicName(test.dir); got != test.want {
+			t.Errorf("TopicName(%q) = %q, want %q", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestReadmeDepth(t *testing.T) {
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"README.md", 0},
+		{"datastores/README.md", 1},
+		{"distributed_systems/consensus/README.md", 2},
+		{"languages-paradigms/functional_programming/type-theory/README.md", 3},
+	}
+
+	for _, test := range tests {
+		if got := ReadmeDepth(test.path); got != test.want {
+			t.Errorf("ReadmeDepth(%q) = %d, want %d", test.path, got, test.want)
+		}
+	}
+}
+
+func TestIndexerMaxDepth(t *testing.T) {
+	dir := t.TempDir()
+	writeReadme(t, dir, "datastores", budgetReadme("datastores"))
+	writeReadme(t, dir, "distributed_systems/consensus", budgetReadme("consensus"))
+	writeReadme(t, dir, "languages/functional/types", budgetReadme("types"))
+
+	tests := []struct {
+		maxDepth int
+		want     []string
+	}{
+		{0, []string{"Datastores", "DistributedSystems/Consensus", "Languages/Functional/Types"}},
+		{1, []string{"Datastores"}},
+		{2, []string{"Datastores", "DistributedSystems/Consensus"}},
+		{3, []string{"Datastores", "DistributedSystems/Consensus", "Languages/Functional/Types"}},
+	}
+
+	for _, test := range tests {
+		ix := NewIndexer(NewLocalSource(dir), "papers-we-love", "papers-we-love", "master", time.Hour, SearchBudget{APICalls: 10})
+		ix.MaxDepth = test.maxDepth
+		catalog, err := ix.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, entry := range catalog.Entries {
+			got = append(got, entry.Topic)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("MaxDepth %d: indexed topics %q, want %q", test.maxDepth, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PaperKind describes what a paper link points to.
+type PaperKind string
+
+// Paper kinds recognised by the default rules.
+const (
+	KindPDF        PaperKind = "PDF"
+	KindPostScript PaperKind = "PostScript"
+	KindArxiv      PaperKind = "arXiv"
+	KindDOI        PaperKind = "DOI"
+	KindACM        PaperKind = "ACM DL"
+	KindUSENIX     PaperKind = "USENIX"
+)
+
+// PaperRule matches links of a single kind. A rule with Extensions matches
+// any link whose path ends in one of them. Otherwise the link must use
+// Scheme, if set, and be on Host or one of its subdomains, if set, with a
+// path matching Path, if set.
+type PaperRule struct {
+	Kind       PaperKind
+	Extensions []string
+	Scheme     string
+	Host       string
+	Path       *regexp.Regexp
+}
+
+// Match returns true if the rule matches the link u.
+func (r *PaperRule) Match(u *url.URL) bool {
+	if len(r.Extensions) > 0 {
+		p := strings.ToLower(u.Path)
+		if u.Opaque != "" {
+			p = strings.ToLower(u.Opaque)
+		}
+		for _, ext := range r.Extensions {
+			if strings.HasSuffix(p, strings.ToLower(ext)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if r.Scheme != "" && !strings.EqualFold(u.Scheme, r.Scheme) {
+		return false
+	}
+	if r.Host != "" {
+		host := strings.ToLower(u.Hostname())
+		if host != r.Host && !strings.HasSuffix(host, "."+r.Host) {
+			return false
+		}
+	}
+	if r.Path != nil && !r.Path.MatchString(u.Path) {
+		return false
+	}
+
+	return r.Scheme != "" || r.Host != ""
+}
+
+// DefaultPaperRules are the rules every Classifier starts with.
+var DefaultPaperRules = []PaperRule{
+	{Kind: KindPDF, Extensions: []string{".pdf"}},
+	{Kind: KindPostScript, Extensions: []string{".ps", ".ps.gz", ".ps.z"}},
+	{Kind: KindArxiv, Host: "arxiv.org", Path: regexp.MustCompile(`^/(abs|pdf)/`)},
+	{Kind: KindDOI, Scheme: "doi"},
+	{Kind: KindDOI, Host: "doi.org", Path: regexp.MustCompile(`^/10\.`)},
+	{Kind: KindACM, Host: "dl.acm.org", Path: regexp.MustCompile(`^/(doi|citation\.cfm)`)},
+	{Kind: KindUSENIX, Host: "usenix.org", Path: regexp.MustCompile(`^/(conference|legacy|publications)/`)},
+}
+
+// Classifier decides whether a link points to a paper using an ordered list
+// of rules. The first matching rule wins.
+type Classifier struct {
+	Rules []PaperRule
+}
+
+// NewClassifier returns a Classifier using extra followed by the default
+// rules, so extra rules override the defaults for the links they match.
+func NewClassifier(extra []PaperRule) *Classifier {
+	rules := make([]PaperRule, 0, len(extra)+len(DefaultPaperRules))
+	rules = append(rules, extra...)
+	rules = append(rules, DefaultPaperRules...)
+
+	return &Classifier{Rules: rules}
+}
+
+// DefaultClassifier uses only the default rules.
+var DefaultClassifier = NewClassifier(nil)
+
+// Classify returns the kind of paper location links to. It returns false if
+// location is not a paper.
+func (c *Classifier) Classify(location string) (PaperKind, bool) {
+	u, err := url.Parse(strings.TrimSpace(location))
+	if err != nil {
+		return "", false
+	}
+
+	for i := range c.Rules {
+		if c.Rules[i].Match(u) {
+			return c.Rules[i].Kind, true
+		}
+	}
+
+	return "", false
+}
+
+// IsPaper returns true if the default rules recognise location as a paper.
+func IsPaper(location string) bool {
+	_, ok := DefaultClassifier.Classify(location)
+	return ok
+}
+
+// ParsePaperRules parses a comma separated list of extra rules. Each rule is
+// written kind:pattern. A pattern starting with "." is a file extension,
+// anything else is a host optionally followed by a path regular expression,
+// for example "DjVu:.djvu" or "HAL:hal.science/document$".
+func ParsePaperRules(spec string) ([]PaperRule, error) {
+	var rules []PaperRule
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		i := strings.Index(field, ":")
+		if i <= 0 || i == len(field)-1 {
+			return nil, fmt.Errorf("invalid paper rule %q", field)
+		}
+		kind, pattern := PaperKind(field[:i]), field[i+1:]
+
+		if strings.HasPrefix(pattern, ".") {
+			rules = append(rules, PaperRule{Kind: kind, Extensions: []string{pattern}})
+			continue
+		}
+
+		rule := PaperRule{Kind: kind, Host: strings.ToLower(pattern)}
+		if j := strings.Index(pattern, "/"); j >= 0 {
+			re, err := regexp.Compile("^" + pattern[j:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid paper rule %q: %s", field, err)
+			}
+			rule.Host = strings.ToLower(pattern[:j])
+			rule.Path = re
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
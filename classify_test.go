@@ -0,0 +1,103 @@
+package main
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		location string
+		kind     PaperKind
+		ok       bool
+	}{
+		{"https://example.org/papers/paxos.pdf", KindPDF, true},
+		{"https://example.org/papers/PAXOS.PDF", KindPDF, true},
+		{"paxos.pdf", KindPDF, true},
+		{"https://example.org/lamport.ps.gz", KindPostScript, true},
+		{"https://arxiv.org/abs/1234.5678", KindArxiv, true},
+		{"https://export.arxiv.org/abs/1234.5678v2", KindArxiv, true},
+		{"https://arxiv.org/list/cs.DC/recent", "", false},
+		{"doi:10.1145/359545.359563", KindDOI, true},
+		{"https://doi.org/10.1145/359545.359563", KindDOI, true},
+		{"https://dl.acm.org/doi/10.1145/359545.359563", KindACM, true},
+		{"https://dl.acm.org/citation.cfm?id=359563", KindACM, true},
+		{"https://dl.acm.org/profile/81100000000", "", false},
+		{"https://www.usenix.org/conference/osdi14/technical-sessions/presentation/ongaro", KindUSENIX, true},
+		{"https://ieeexplore.ieee.org/document/1234567", "", false},
+		{"https://www.youtube.com/watch?v=JEpsBg0AO6o", "", false},
+		{"https://vimeo.com/12345", "", false},
+		{"https://www.slideshare.net/someone/paxos", "", false},
+		{"https://speakerdeck.com/someone/raft", "", false},
+		{"https://github.com/papers-we-love/papers-we-love", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		kind, ok := DefaultClassifier.Classify(test.location)
+		if kind != test.kind || ok != test.ok {
+			t.Errorf("Classify(%q) = %q, %t, want %q, %t", test.location, kind, ok, test.kind, test.ok)
+		}
+		if IsPaper(test.location) != test.ok {
+			t.Errorf("IsPaper(%q) = %t, want %t", test.location, !test.ok, test.ok)
+		}
+	}
+}
+
+func TestClassifyCustomRules(t *testing.T) {
+	rules, err := ParsePaperRules("IEEE:ieeexplore.ieee.org/(document|stamp)/, DjVu:.djvu, Slides:usenix.org/.*slides.*\\.pdf$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	classifier := NewClassifier(rules)
+
+	tests := []struct {
+		location string
+		kind     PaperKind
+		ok       bool
+	}{
+		{"https://ieeexplore.ieee.org/document/1234567", "IEEE", true},
+		{"https://ieeexplore.ieee.org/search/searchresult.jsp", "", false},
+		{"https://example.org/scan.DJVU", "DjVu", true},
+		{"https://www.usenix.org/sites/default/files/conference/osdi14/slides-ongaro.pdf", "Slides", true},
+		{"https://www.usenix.org/system/files/conference/osdi14/osdi14-paper-ongaro.pdf", KindPDF, true},
+		{"https://arxiv.org/abs/1234.5678", KindArxiv, true},
+	}
+
+	for _, test := range tests {
+		kind, ok := classifier.Classify(test.location)
+		if kind != test.kind || ok != test.ok {
+			t.Errorf("Classify(%q) = %q, %t, want %q, %t", test.location, kind, ok, test.kind, test.ok)
+		}
+	}
+}
+
+func TestParsePaperRules(t *testing.T) {
+	tests := []struct {
+		spec  string
+		rules int
+		ok    bool
+	}{
+		{"", 0, true},
+		{" , ", 0, true},
+		{"DjVu:.djvu", 1, true},
+		{"HAL:hal.science/document$,DjVu:.djvu", 2, true},
+		{"djvu", 0, false},
+		{":.djvu", 0, false},
+		{"DjVu:", 0, false},
+		{"HAL:hal.science/document(", 0, false},
+		{"DjVu:.djvu,broken", 0, false},
+	}
+
+	for _, test := range tests {
+		rules, err := ParsePaperRules(test.spec)
+		if (err == nil) != test.ok || len(rules) != test.rules {
+			t.Errorf("ParsePaperRules(%q) = %d rules, %v, want %d rules, ok %t", test.spec, len(rules), err, test.rules, test.ok)
+		}
+	}
+
+	rules, err := ParsePaperRules("HAL:HAL.Science/document$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[0].Kind != "HAL" || rules[0].Host != "hal.science" || rules[0].Path.String() != "^/document$" {
+		t.Errorf("ParsePaperRules() = %+v, want kind HAL on hal.science with path ^/document$", rules[0])
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imwally/love-a-paper/mdlinks"
+)
+
+// Problem is a broken link found by the linter.
+type Problem struct {
+	File   string
+	Link   mdlinks.Link
+	Reason string
+}
+
+func (p *Problem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", p.File, p.Link.Line, p.Link.Column, p.Link.Location, p.Reason)
+}
+
+// Linter checks the links in the markdown files of a repository checkout.
+type Linter struct {
+	// Root is the repository checkout. Root relative links are resolved
+	// against it and relative links may not point outside of it.
+	Root string
+
+	// CheckRemote enables probing absolute http and https links, at most
+	// Concurrency at a time.
+	CheckRemote bool
+	Concurrency int
+	client      *http.Client
+
+	mu   sync.Mutex
+	dirs map[string]map[string]bool
+}
+
+// NewLinter returns a Linter for the checkout at root. Remote links are
+// probed with the given timeout.
+func NewLinter(root string, checkRemote bool, concurrency int, timeout time.Duration) *Linter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Linter{
+		Root:        root,
+		CheckRemote: checkRemote,
+		Concurrency: concurrency,
+		client:      &http.Client{Timeout: timeout},
+		dirs:        make(map[string]map[string]bool),
+	}
+}
+
+// Lint returns the broken links in the markdown files below the root, in
+// file and document order.
+func (l *Linter) Lint() ([]Problem, error) {
+	files, err := MarkdownFiles(l.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	var remote []Problem
+	for _, file := range files {
+		markdown, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, link := range mdlinks.Links(markdown) {
+			u, err := url.Parse(link.Location)
+			if err != nil {
+				problems = append(problems, Problem{file, link, "invalid URL"})
+				continue
+			}
+
+			switch {
+			case u.Scheme == "http" || u.Scheme == "https":
+				if l.CheckRemote {
+					remote = append(remote, Problem{File: file, Link: link})
+				}
+			case u.Scheme != "" || u.Host != "":
+				// mailto:, ftp: and the like are not checked.
+			case u.Path == "":
+				// A fragment or query on the README itself.
+			default:
+				if reason := l.checkRelative(file, u.Path); reason != "" {
+					problems = append(problems, Problem{file, link, reason})
+				}
+			}
+		}
+	}
+
+	problems = append(problems, l.checkRemote(remote)...)
+	sortProblems(files, problems)
+
+	return problems, nil
+}
+
+// sort orders problems by the order of their file in files and then by
+// position.
+func sortProblems(files []string, problems []Problem) {
+	order := make(map[string]int)
+	for i, file := range files {
+		order[file] = i
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := &problems[i], &problems[j]
+		if order[a.File] != order[b.File] {
+			return order[a.File] < order[b.File]
+		}
+		if a.Link.Line != b.Link.Line {
+			return a.Link.Line < b.Link.Line
+		}
+		return a.Link.Column < b.Link.Column
+	})
+}
+
+// checkRelative returns why the relative link target in file is broken,
+// or an empty string if it exists.
+func (l *Linter) checkRelative(file, target string) string {
+	target, err := url.PathUnescape(target)
+	if err != nil {
+		return "invalid path escape"
+	}
+
+	var rel string
+	if strings.HasPrefix(target, "/") {
+		rel = path.Clean(strings.TrimPrefix(target, "/"))
+	} else {
+		dir, err := filepath.Rel(l.Root, filepath.Dir(file))
+		if err != nil {
+			return err.Error()
+		}
+		rel = path.Join(filepath.ToSlash(dir), target)
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "points outside of the repository"
+	}
+	if rel == "." {
+		return ""
+	}
+
+	if !l.exists(rel) {
+		return "no such file"
+	}
+
+	return ""
+}
+
+// exists returns true if the slash separated path rel exists below the
+// root with exactly the same case, even on case insensitive file systems.
+func (l *Linter) exists(rel string) bool {
+	dir := l.Root
+	for _, name := range strings.Split(rel, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		if !l.listing(dir)[name] {
+			return false
+		}
+		dir = filepath.Join(dir, name)
+	}
+
+	return true
+}
+
+// listing returns the names of the entries of dir.
+func (l *Linter) listing(dir string) map[string]bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if names, ok := l.dirs[dir]; ok {
+		return names
+	}
+
+	names := make(map[string]bool)
+	infos, _ := ioutil.ReadDir(dir)
+	for _, info := range infos {
+		names[info.Name()] = true
+	}
+	l.dirs[dir] = names
+
+	return names
+}
+
+// checkRemote probes the links of candidates, each URL only once, and
+// returns the ones that are broken.
+func (l *Linter) checkRemote(candidates []Problem) []Problem {
+	reasons := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, l.Concurrency)
+
+	for _, c := range candidates {
+		location := c.Link.Location
+		mu.Lock()
+		_, seen := reasons[location]
+		reasons[location] = ""
+		mu.Unlock()
+		if seen {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			reason := l.probe(location)
+			mu.Lock()
+			reasons[location] = reason
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	var problems []Problem
+	for _, c := range candidates {
+		if reason := reasons[c.Link.Location]; reason != "" {
+			c.Reason = reason
+			problems = append(problems, c)
+		}
+	}
+
+	return problems
+}
+
+// probe returns why link can not be fetched, or an empty string if it can.
+// Servers that refuse HEAD requests are retried with a GET.
+func (l *Linter) probe(link string) string {
+	status, err := l.request("HEAD", link)
+	if err == nil && status >= 400 {
+		status, err = l.request("GET", link)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if status >= 400 {
+		return http.StatusText(status)
+	}
+
+	return ""
+}
+
+func (l *Linter) request(method, link string) (int, error) {
+	req, err := http.NewRequest(method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "mdlinks")
+	if method == "GET" {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// lint runs the lint subcommand, printing broken links to stdout and
+// errors to stderr, and returns its exit code: 0 if every link is fine, 1 if
+// any are broken and 2 on errors.
+func lint(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	checkRemote := flags.Bool("check-remote", false, "also probe absolute http and https links")
+	concurrency := flags.Int("concurrency", 8, "maximum `number` of remote links probed at once")
+	timeout := flags.Duration("timeout", 15*time.Second, "timeout for each remote probe")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: mdlinks lint [flags] [directory ...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+
+	roots := flags.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	code := 0
+	for _, root := range roots {
+		problems, err := NewLinter(root, *checkRemote, *concurrency, *timeout).Lint()
+		if err != nil {
+			fmt.Fprintf(stderr, "mdlinks: %s\n", err)
+			return 2
+		}
+		for _, p := range problems {
+			fmt.Fprintln(stdout, p.String())
+			code = 1
+		}
+	}
+
+	return code
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeFiles creates files, keyed by slash separated path, below dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"README.md": "* [Systems](distributed_systems/README.md)\n* [Contributing](#contributing)\n* [Mail](mailto:pwl@example.org)\n",
+		"distributed_systems/README.md": strings.Join([]string{
+			"* [Paxos](Paxos.pdf)",
+			"* [paxos](paxos.pdf)",
+			"* [Dynamo](../datastores/dynamo.pdf)",
+			"* [Bigtable](/Datastores/bigtable.pdf)",
+			"* [Spanner](/datastores/spanner.pdf#page=2)",
+			"* [Outside](../../papers.pdf)",
+			"* [Root](/../papers.pdf)",
+			"* [Escaped](a%20b.pdf)",
+			`* <a href="chubby.pdf">Chubby</a> and <a href="missing.pdf">Missing</a>`,
+			"* [Remote](https://example.org/paper.pdf)",
+			"",
+		}, "\n"),
+		"distributed_systems/Paxos.pdf":  "",
+		"distributed_systems/a b.pdf":    "",
+		"distributed_systems/chubby.pdf": "",
+		"datastores/dynamo.pdf":          "",
+		"datastores/bigtable.pdf":        "",
+		"datastores/spanner.pdf":         "",
+	})
+
+	problems, err := NewLinter(root, false, 1, time.Second).Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range problems {
+		rel, err := filepath.Rel(root, p.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s:%d:%d: %s: %s", filepath.ToSlash(rel), p.Link.Line, p.Link.Column, p.Link.Location, p.Reason))
+	}
+	want := []string{
+		"distributed_systems/README.md:2:3: paxos.pdf: no such file",
+		"distributed_systems/README.md:4:3: /Datastores/bigtable.pdf: no such file",
+		"distributed_systems/README.md:6:3: ../../papers.pdf: points outside of the repository",
+		"distributed_systems/README.md:7:3: /../papers.pdf: points outside of the repository",
+		"distributed_systems/README.md:9:39: missing.pdf: no such file",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLintCheckRemote(t *testing.T) {
+	var requests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/alive.pdf", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	})
+	mux.HandleFunc("/no-head.pdf", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/gone.pdf", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"README.md": fmt.Sprintf("* [Alive](%[1]s/alive.pdf)\n* [No HEAD](%[1]s/no-head.pdf)\n* [Gone](%[1]s/gone.pdf)\n* [Gone again](%[1]s/gone.pdf)\n", server.URL),
+	})
+
+	problems, err := NewLinter(root, false, 2, time.Second).Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 || requests != 0 {
+		t.Errorf("without -check-remote got %d problems after %d requests, want none", len(problems), requests)
+	}
+
+	problems, err = NewLinter(root, true, 2, time.Second).Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, fmt.Sprintf("%d: %s", p.Link.Line, p.Reason))
+	}
+	if want := "3: Not Found,4: Not Found"; strings.Join(got, ",") != want {
+		t.Errorf("got problems %q, want %s", got, want)
+	}
+	// alive.pdf takes a HEAD, no-head.pdf a HEAD and a GET and gone.pdf,
+	// probed once for both links, a HEAD and a GET.
+	if requests != 5 {
+		t.Errorf("sent %d requests, want 5", requests)
+	}
+}
+
+func TestLintExitCode(t *testing.T) {
+	clean := t.TempDir()
+	writeFiles(t, clean, map[string]string{
+		"README.md": "* [Paxos](paxos.pdf)\n",
+		"paxos.pdf": "",
+	})
+	broken := t.TempDir()
+	writeFiles(t, broken, map[string]string{
+		"README.md": "* [Paxos](paxos.pdf)\n",
+	})
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+	}{
+		{[]string{clean}, 0, ""},
+		{[]string{clean, broken}, 1, filepath.Join(broken, "README.md") + ":1:3: paxos.pdf: no such file\n"},
+		{[]string{filepath.Join(clean, "missing")}, 2, ""},
+		{[]string{"-concurrency", "many", clean}, 2, ""},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := lint(test.args, &stdout, &stderr); code != test.code {
+			t.Errorf("lint(%q) = %d, want %d (stderr %q)", test.args, code, test.code, stderr.String())
+		}
+		if stdout.String() != test.stdout {
+			t.Errorf("lint(%q) printed %q, want %q", test.args, stdout.String(), test.stdout)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// Command mdlinks prints the links found in markdown documents.
+//
+// Usage:
+//
+//	mdlinks [flags] [file or directory ...]
+//	mdlinks lint [flags] [directory ...]
+//
+// Directories are searched recursively for markdown files. With no
+// arguments, or an argument of "-", markdown is read from standard input.
+// Every link is printed with the file and position it was found at, its
+// kind, name, location, title, enclosing section and annotations, as JSON
+// lines, CSV or TSV.
+//
+// The lint subcommand checks that every relative link in the markdown files
+// of a repository checkout points at a file that exists, matching case, and
+// prints the broken ones as file:line:column. With -check-remote absolute
+// links are probed too. It exits with status 1 if any link is broken.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/imwally/love-a-paper/mdlinks"
+)
+
+// Record is a link as printed.
+type Record struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Title    string `json:"title,omitempty"`
+	Section  string `json:"section,omitempty"`
+
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// columns are the CSV and TSV header.
+var columns = []string{"file", "line", "column", "kind", "name", "location", "title", "section", "annotations"}
+
+// Row returns the record's fields in column order.
+func (r *Record) Row() []string {
+	return []string{
+		r.File,
+		strconv.Itoa(r.Line),
+		strconv.Itoa(r.Column),
+		r.Kind,
+		r.Name,
+		r.Location,
+		r.Title,
+		r.Section,
+		strings.Join(r.Annotations, ";"),
+	}
+}
+
+// NewRecord returns link, found in file, as printed.
+func NewRecord(file string, link *mdlinks.Link) *Record {
+	r := &Record{
+		File:     file,
+		Line:     link.Line,
+		Column:   link.Column,
+		Kind:     string(link.Kind),
+		Name:     link.Name,
+		Location: link.Location,
+		Title:    link.Title,
+		Section:  link.Section(),
+	}
+	for _, a := range link.Annotations {
+		r.Annotations = append(r.Annotations, string(a))
+	}
+
+	return r
+}
+
+// Filter selects which links are printed.
+type Filter struct {
+	Kinds      []mdlinks.Kind
+	Extensions []string
+	Hosts      []string
+	Relative   bool
+	Absolute   bool
+}
+
+// ParseFilter returns the Filter set by the -kind, -ext, -host, -relative
+// and -absolute flag values.
+func ParseFilter(kinds, exts, hosts string, relative, absolute bool) (*Filter, error) {
+	if relative && absolute {
+		return nil, fmt.Errorf("-relative and -absolute can not be used together")
+	}
+
+	k, err := parseKinds(kinds)
+	if err != nil {
+		return nil, err
+	}
+
+	var extensions []string
+	for _, ext := range splitList(exts) {
+		extensions = append(extensions, strings.TrimPrefix(ext, "."))
+	}
+
+	return &Filter{
+		Kinds:      k,
+		Extensions: extensions,
+		Hosts:      splitList(hosts),
+		Relative:   relative,
+		Absolute:   absolute,
+	}, nil
+}
+
+// Match returns true if link passes every filter that is set.
+func (f *Filter) Match(link *mdlinks.Link) bool {
+	if len(f.Kinds) > 0 && len(mdlinks.FilterKinds([]mdlinks.Link{*link}, f.Kinds...)) == 0 {
+		return false
+	}
+
+	u, err := url.Parse(link.Location)
+	if err != nil {
+		return false
+	}
+
+	absolute := u.IsAbs() || u.Host != ""
+	if f.Relative && absolute {
+		return false
+	}
+	if f.Absolute && !absolute {
+		return false
+	}
+
+	if len(f.Hosts) > 0 && !matchHost(u.Hostname(), f.Hosts) {
+		return false
+	}
+
+	if len(f.Extensions) > 0 {
+		ext := strings.TrimPrefix(strings.ToLower(path.Ext(u.Path)), ".")
+		if !contains(f.Extensions, ext) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchHost returns true if host is one of hosts or a subdomain of one.
+func matchHost(host string, hosts []string) bool {
+	host = strings.ToLower(host)
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitList splits a comma separated flag value into its lower cased,
+// non-empty items.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// parseKinds parses a comma separated list of link kinds.
+func parseKinds(value string) ([]mdlinks.Kind, error) {
+	var kinds []mdlinks.Kind
+	for _, item := range splitList(value) {
+		kind := mdlinks.Kind(item)
+		known := false
+		for _, k := range mdlinks.AllKinds {
+			if k == kind {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown link kind %q", item)
+		}
+		kinds = append(kinds, kind)
+	}
+
+	return kinds, nil
+}
+
+// IsMarkdown returns true if name has a markdown file extension.
+func IsMarkdown(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown", ".mdown", ".mkd":
+		return true
+	}
+
+	return false
+}
+
+// MarkdownFiles returns the markdown files below dir, in lexical order.
+// Hidden directories such as .git are skipped.
+func MarkdownFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if IsMarkdown(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// Writer prints records in one of the output formats.
+type Writer interface {
+	Write(r *Record) error
+	Flush() error
+}
+
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonWriter) Write(r *Record) error {
+	return w.enc.Encode(r)
+}
+
+func (w *jsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvWriter) Write(r *Record) error {
+	return w.w.Write(r.Row())
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type tsvWriter struct {
+	w io.Writer
+}
+
+// tsvEscaper escapes the characters that would break a TSV row.
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func (w *tsvWriter) row(fields []string) error {
+	escaped := make([]string, len(fields))
+	for i, field := range fields {
+		escaped[i] = tsvEscaper.Replace(field)
+	}
+	_, err := fmt.Fprintln(w.w, strings.Join(escaped, "\t"))
+
+	return err
+}
+
+func (w *tsvWriter) Write(r *Record) error {
+	return w.row(r.Row())
+}
+
+func (w *tsvWriter) Flush() error {
+	return nil
+}
+
+// NewWriter returns a Writer for format, writing the header for formats
+// that have one unless header is false.
+func NewWriter(out io.Writer, format string, header bool) (Writer, error) {
+	switch format {
+	case "json":
+		return &jsonWriter{enc: json.NewEncoder(out)}, nil
+	case "csv":
+		w := &csvWriter{w: csv.NewWriter(out)}
+		if header {
+			if err := w.w.Write(columns); err != nil {
+				return nil, err
+			}
+		}
+		return w, nil
+	case "tsv":
+		w := &tsvWriter{w: out}
+		if header {
+			if err := w.row(columns); err != nil {
+				return nil, err
+			}
+		}
+		return w, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q, want json, csv or tsv", format)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mdlinks: ")
+
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(lint(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	format := flag.String("format", "json", "output `format`: json, csv or tsv")
+	header := flag.Bool("header", true, "print a header row in csv and tsv output")
+	kinds := flag.String("kind", "", "comma separated link `kinds` to print (default all)")
+	exts := flag.String("ext", "", "comma separated file `extensions` links must end in, e.g. pdf,ps")
+	hosts := flag.String("host", "", "comma separated `hosts` links must point at, subdomains included")
+	relative := flag.Bool("relative", false, "only print relative links")
+	absolute := flag.Bool("absolute", false, "only print absolute links")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: mdlinks [flags] [file or directory ...]\n")
+		fmt.Fprintf(os.Stderr, "       mdlinks lint [flags] [directory ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	filter, err := ParseFilter(*kinds, *exts, *hosts, *relative, *absolute)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w, err := NewWriter(os.Stdout, *format, *header)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	failed := false
+	for _, arg := range args {
+		files := []string{arg}
+		if arg != "-" {
+			info, err := os.Stat(arg)
+			if err != nil {
+				log.Print(err)
+				failed = true
+				continue
+			}
+			if info.IsDir() {
+				files, err = MarkdownFiles(arg)
+				if err != nil {
+					log.Print(err)
+					failed = true
+					continue
+				}
+			}
+		}
+
+		for _, file := range files {
+			if err := printLinks(w, filter, file); err != nil {
+				log.Print(err)
+				failed = true
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printLinks writes the links in file that pass filter. A file of "-" is
+// standard input.
+func printLinks(w Writer, filter *Filter, file string) error {
+	var markdown []byte
+	var err error
+	if file == "-" {
+		markdown, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		markdown, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	return WriteLinks(w, filter, file, markdown)
+}
+
+// WriteLinks writes the links in markdown, read from file, that pass
+// filter.
+func WriteLinks(w Writer, filter *Filter, file string, markdown []byte) error {
+	for _, link := range mdlinks.Links(markdown) {
+		if !filter.Match(&link) {
+			continue
+		}
+		if err := w.Write(NewRecord(file, &link)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// readme is the fixture the output and filters are tested with.
+var readme = filepath.Join("testdata", "README.md")
+
+// TestWriteLinks checks the links of the fixture README printed in each
+// format against testdata/README.<format>.golden. Run with -update to
+// rewrite the golden files.
+func TestWriteLinks(t *testing.T) {
+	markdown, err := ioutil.ReadFile(readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"json", "csv", "tsv"} {
+		var out bytes.Buffer
+		w, err := NewWriter(&out, format, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteLinks(w, &Filter{}, "README.md", markdown); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		golden := filepath.Join("testdata", "README."+format+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != string(want) {
+			t.Errorf("%s output:\ngot:\n%s\nwant:\n%s", format, out.String(), want)
+		}
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	r := &Record{File: "a\tb.md", Line: 1, Column: 2, Kind: "inline", Name: "line\nbreak, \"quoted\"", Location: `C:\papers`}
+	tests := []struct {
+		format string
+		header bool
+		want   string
+	}{
+		{"csv", false, "a\tb.md,1,2,inline,\"line\nbreak, \"\"quoted\"\"\",C:\\papers,,,\n"},
+		{"tsv", false, "a\\tb.md\t1\t2\tinline\tline\\nbreak, \"quoted\"\tC:\\\\papers\t\t\t\n"},
+		{"tsv", true, "file\tline\tcolumn\tkind\tname\tlocation\ttitle\tsection\tannotations\n" +
+			"a\\tb.md\t1\t2\tinline\tline\\nbreak, \"quoted\"\tC:\\\\papers\t\t\t\n"},
+		{"json", true, `{"file":"a\tb.md","line":1,"column":2,"kind":"inline","name":"line\nbreak, \"quoted\"","location":"C:\\papers"}` + "\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		w, err := NewWriter(&out, test.format, test.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.want {
+			t.Errorf("%s, header %t:\ngot  %q\nwant %q", test.format, test.header, out.String(), test.want)
+		}
+	}
+
+	if _, err := NewWriter(&bytes.Buffer{}, "xml", true); err == nil {
+		t.Error("NewWriter() accepted an unknown format")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	markdown, err := ioutil.ReadFile(readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		kinds, exts, hosts string
+		relative, absolute bool
+		want               []string
+	}{
+		{want: []string{
+			"paxos.pdf",
+			"https://www.allthingsdistributed.com/files/amazon-dynamo-sosp2007.pdf",
+			"https://raft.github.io/raft.pdf",
+			"https://arxiv.org/abs/1234.5678",
+			"https://www.youtube.com/watch?v=CWF3QnfihL4",
+			"../datastores/bigtable.PS",
+			"diagram.png",
+			"http://lamport.azurewebsites.net/pubs/pubs.html#time-clocks",
+		}},
+		{kinds: "reference, autolink", want: []string{
+			"https://raft.github.io/raft.pdf",
+			"https://arxiv.org/abs/1234.5678",
+		}},
+		{kinds: "HTML,image", want: []string{"../datastores/bigtable.PS", "diagram.png"}},
+		{exts: "pdf", want: []string{
+			"paxos.pdf",
+			"https://www.allthingsdistributed.com/files/amazon-dynamo-sosp2007.pdf",
+			"https://raft.github.io/raft.pdf",
+		}},
+		{exts: ".ps,.PNG", want: []string{"../datastores/bigtable.PS", "diagram.png"}},
+		{hosts: "github.io,youtube.com", want: []string{
+			"https://raft.github.io/raft.pdf",
+			"https://www.youtube.com/watch?v=CWF3QnfihL4",
+		}},
+		{hosts: "ARXIV.org", exts: "pdf"},
+		{relative: true, want: []string{"paxos.pdf", "../datastores/bigtable.PS", "diagram.png"}},
+		{relative: true, kinds: "inline", exts: "pdf", want: []string{"paxos.pdf"}},
+		{absolute: true, kinds: "inline", want: []string{
+			"https://www.allthingsdistributed.com/files/amazon-dynamo-sosp2007.pdf",
+			"https://www.youtube.com/watch?v=CWF3QnfihL4",
+			"http://lamport.azurewebsites.net/pubs/pubs.html#time-clocks",
+		}},
+	}
+
+	for _, test := range tests {
+		filter, err := ParseFilter(test.kinds, test.exts, test.hosts, test.relative, test.absolute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		w := recordWriter(func(r *Record) { got = append(got, r.Location) })
+		if err := WriteLinks(w, filter, readme, markdown); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %q, want %q", test, got, test.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	if _, err := ParseFilter("inline,hyperlink", "", "", false, false); err == nil {
+		t.Error("ParseFilter() accepted an unknown kind")
+	}
+	if _, err := ParseFilter("", "", "", true, true); err == nil {
+		t.Error("ParseFilter() accepted -relative with -absolute")
+	}
+}
+
+// recordWriter is a Writer calling itself with every record.
+type recordWriter func(r *Record)
+
+func (w recordWriter) Write(r *Record) error {
+	w(r)
+	return nil
+}
+
+func (w recordWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imwally/love-a-paper/mdlinks"
+)
+
+// Config holds the bot settings. Every setting is read from an environment
+// variable and falls back to a sensible default when the variable is unset.
+type Config struct {
+	// Owner and Repo name the Github repository papers are taken from.
+	Owner string
+	Repo  string
+
+	// GithubToken authenticates Github API requests. If it is empty the
+	// token is read from GithubTokenFile, if set.
+	GithubToken     string
+	GithubTokenFile string
+
+	// CacheDir is where Github API responses are cached. Entries older than
+	// CacheTTL are discarded and the cache is pruned once it grows past
+	// CacheMaxSize bytes. A CacheMaxSize of zero disables the cache.
+	CacheDir     string
+	CacheMaxSize int64
+	CacheTTL     time.Duration
+
+	// Source selects where READMEs are read from: "github", "local" or
+	// "tarball". SourceDir is the checkout used by the local source.
+	Source    string
+	SourceDir string
+
+	// IndexRef is the branch, tag or commit the catalog is built from.
+	IndexRef string
+
+	// IndexRefresh is how long a catalog is used before it is rebuilt.
+	IndexRefresh time.Duration
+
+	// SkipSections are README section headings whose links are ignored.
+	SkipSections []string
+
+	// TopicMaxDepth limits how deeply nested topic directories may be.
+	// Zero means no limit.
+	TopicMaxDepth int
+
+	// PaperRules are recognised as papers in addition to the default rules,
+	// which they take precedence over.
+	PaperRules []PaperRule
+
+	// Markers annotate links in addition to the default markers.
+	Markers []mdlinks.Marker
+
+	// LinkForm is which link of a paper with both an external link and a
+	// copy in the repository is posted.
+	LinkForm LinkForm
+
+	// BlobStyle selects how papers hosted in the repository are linked.
+	BlobStyle BlobStyle
+
+	// LinkCheck enables checking paper links before they are posted.
+	// Requests time out after LinkCheckTimeout. Dead links are replaced by a
+	// snapshot found with the Wayback Machine availability API at
+	// WaybackURL, unless it is empty.
+	LinkCheck        bool
+	LinkCheckTimeout time.Duration
+	WaybackURL       string
+
+	// PDFMetadata enables reading the title, authors and year of a paper
+	// from the PDF itself. Downloads time out after PDFTimeout and PDFs
+	// larger than PDFMaxSize bytes are skipped.
+	PDFMetadata bool
+	PDFTimeout  time.Duration
+	PDFMaxSize  int64
+
+	// Publishers names the services papers are posted to, each given
+	// PublishTimeout to post.
+	Publishers     []string
+	PublishTimeout time.Duration
+
+	// TwitterAPIURL is the base URL of the Twitter API. The twitter
+	// publisher uses OAuth 2.0 if TwitterClientID is set, keeping its
+	// rotating tokens in TwitterTokenFile, and OAuth 1.0a with the consumer
+	// key and user access token otherwise.
+	TwitterAPIURL           string
+	TwitterClientID         string
+	TwitterClientSecret     string
+	TwitterClientSecretFile string
+	TwitterRedirectURL      string
+	TwitterTokenFile        string
+	TwitterConsumerKey      string
+	TwitterConsumerSecret   string
+	TwitterAccessToken      string
+	TwitterAccessSecret     string
+
+	// MastodonURL is the instance the mastodon publisher posts to with
+	// MastodonToken, or the token read from MastodonTokenFile.
+	MastodonURL        string
+	MastodonToken      string
+	MastodonTokenFile  string
+	MastodonVisibility string
+	MastodonLanguage   string
+
+	// BlueskyPDSURL is the PDS the bluesky publisher logs in to with
+	// BlueskyIdentifier and BlueskyPassword, or the password read from
+	// BlueskyPasswordFile.
+	BlueskyPDSURL       string
+	BlueskyIdentifier   string
+	BlueskyPassword     string
+	BlueskyPasswordFile string
+	BlueskyLanguage     string
+
+	// Webhooks holds the URL, or the file to read it from, of each
+	// Slack, Discord and Mattermost publisher, keyed by publisher name.
+	Webhooks map[string]WebhookConfig
+
+	// HistoryFile is where posted papers are recorded.
+	HistoryFile string
+
+	// FeedFile stores every posted paper for the feeds. The feeds
+	// show the newest FeedMaxItems of them and are served on FeedAddr, if
+	// set, with FeedURL as the address they are reached at.
+	FeedFile        string
+	FeedMaxItems    int
+	FeedTitle       string
+	FeedDescription string
+	FeedURL         string
+	FeedAddr        string
+
+	// Budget limits the work done while looking for a paper.
+	Budget SearchBudget
+}
+
+// LoadConfig reads the bot configuration from environment variables. It
+// fails if a setting that selects between fixed choices names none of them.
+func LoadConfig() (*Config, error) {
+	config := &Config{
+		Owner:            EnvString("PAPERS_OWNER", "papers-we-love"),
+		Repo:             EnvString("PAPERS_REPO", "papers-we-love"),
+		GithubToken:      os.Getenv("GITHUB_TOKEN"),
+		GithubTokenFile:  os.Getenv("GITHUB_TOKEN_FILE"),
+		CacheDir:         EnvString("HTTP_CACHE_DIR", filepath.Join(os.TempDir(), "love-a-paper")),
+		CacheMaxSize:     int64(EnvInt("HTTP_CACHE_MAX_SIZE", 64<<20)),
+		CacheTTL:         EnvDuration("HTTP_CACHE_TTL", 7*24*time.Hour),
+		Source:           EnvString("PAPER_SOURCE", "github"),
+		SourceDir:        EnvString("PAPER_SOURCE_DIR", "papers-we-love"),
+		IndexRef:         EnvString("INDEX_REF", "master"),
+		IndexRefresh:     EnvDuration("INDEX_REFRESH", 24*time.Hour),
+		SkipSections:     EnvList("SKIP_SECTIONS", []string{"External Papers", "Contributing"}),
+		TopicMaxDepth:    EnvInt("TOPIC_MAX_DEPTH", 0),
+		PaperRules:       EnvPaperRules("PAPER_RULES"),
+		Markers:          EnvMarkers("LINK_MARKERS"),
+		LinkCheck:        EnvBool("LINK_CHECK", true),
+		LinkCheckTimeout: EnvDuration("LINK_CHECK_TIMEOUT", 15*time.Second),
+		WaybackURL:       EnvString("WAYBACK_URL", DefaultWaybackURL),
+		PDFMetadata:      EnvBool("PDF_METADATA", true),
+		PDFTimeout:       EnvDuration("PDF_TIMEOUT", time.Minute),
+		PDFMaxSize:       int64(EnvInt("PDF_MAX_SIZE", 32<<20)),
+		HistoryFile:      EnvString("HISTORY_FILE", "history.jsonl"),
+		Publishers:       EnvList("PUBLISHERS", []string{"twitter"}),
+		PublishTimeout:   EnvDuration("PUBLISH_TIMEOUT", 30*time.Second),
+
+		TwitterAPIURL:           EnvString("TWITTER_API_URL", DefaultTwitterAPI),
+		TwitterClientID:         EnvString("TWITTER_CLIENT_ID", ""),
+		TwitterClientSecret:     EnvString("TWITTER_CLIENT_SECRET", ""),
+		TwitterClientSecretFile: EnvString("TWITTER_CLIENT_SECRET_FILE", ""),
+		TwitterRedirectURL:      EnvString("TWITTER_REDIRECT_URL", "http://127.0.0.1/callback"),
+		TwitterTokenFile:        EnvString("TWITTER_TOKEN_FILE", "twitter-token.json"),
+		TwitterConsumerKey:      EnvString("CONSUMER_KEY", ""),
+		TwitterConsumerSecret:   EnvString("CONSUMER_SECRET", ""),
+		TwitterAccessToken:      EnvString("API_KEY", ""),
+		TwitterAccessSecret:     EnvString("API_SECRET", ""),
+
+		MastodonURL:        EnvString("MASTODON_URL", ""),
+		MastodonToken:      EnvString("MASTODON_TOKEN", ""),
+		MastodonTokenFile:  EnvString("MASTODON_TOKEN_FILE", ""),
+		MastodonVisibility: EnvString("MASTODON_VISIBILITY", "public"),
+		MastodonLanguage:   EnvString("MASTODON_LANGUAGE", "en"),
+
+		BlueskyPDSURL:       EnvString("BLUESKY_PDS_URL", DefaultBlueskyPDS),
+		BlueskyIdentifier:   EnvString("BLUESKY_IDENTIFIER", ""),
+		BlueskyPassword:     EnvString("BLUESKY_PASSWORD", ""),
+		BlueskyPasswordFile: EnvString("BLUESKY_PASSWORD_FILE", ""),
+		BlueskyLanguage:     EnvString("BLUESKY_LANGUAGE", "en"),
+
+		FeedFile:        EnvString("FEED_FILE", "feed.jsonl"),
+		FeedMaxItems:    EnvInt("FEED_MAX_ITEMS", 50),
+		FeedTitle:       EnvString("FEED_TITLE", "Love a Paper"),
+		FeedDescription: EnvString("FEED_DESCRIPTION", "Papers from Papers We Love"),
+		FeedURL:         strings.TrimRight(EnvString("FEED_URL", "http://localhost:8080"), "/"),
+		FeedAddr:        EnvString("FEED_ADDR", ""),
+		Budget: SearchBudget{
+			Attempts: EnvInt("SEARCH_ATTEMPTS", 10),
+			APICalls: EnvInt("SEARCH_API_CALLS", 500),
+		},
+	}
+	config.Webhooks = EnvWebhooks(config.Publishers)
+	if config.WaybackURL == "none" {
+		config.WaybackURL = ""
+	}
+
+	var err error
+	config.BlobStyle, err = ParseBlobStyle(EnvString("BLOB_STYLE", string(BlobViewer)))
+	if err != nil {
+		return nil, fmt.Errorf("BLOB_STYLE: %s", err)
+	}
+	config.LinkForm, err = ParseLinkForm(EnvString("LINK_PREFERENCE", string(FormMirror)))
+	if err != nil {
+		return nil, fmt.Errorf("LINK_PREFERENCE: %s", err)
+	}
+
+	return config, nil
+}
+
+// EnvString returns the value of the environment variable key or def if the
+// variable is unset or empty.
+func EnvString(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return def
+}
+
+// EnvList returns the environment variable key split on commas, with
+// surrounding whitespace and empty items removed. If the variable is unset
+// def is returned.
+func EnvList(key string, def []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// EnvInt returns the environment variable key parsed as an int. If the
+// variable is unset or can not be parsed def is returned.
+func EnvInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("CONFIG: invalid integer %s=%q, using %d", key, value, def)
+		return def
+	}
+
+	return i
+}
+
+// EnvBool returns the environment variable key parsed as a bool. If the
+// variable is unset or can not be parsed def is returned.
+func EnvBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("CONFIG: invalid boolean %s=%q, using %t", key, value, def)
+		return def
+	}
+
+	return b
+}
+
+// EnvDuration returns the environment variable key parsed as a
+// time.Duration. If the variable is unset or can not be parsed def is
+// returned.
+func EnvDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("CONFIG: invalid duration %s=%q, using %s", key, value, def)
+		return def
+	}
+
+	return d
+}
+
+// EnvPaperRules returns the environment variable key parsed with
+// ParsePaperRules. If the variable can not be parsed no rules are returned.
+func EnvPaperRules(key string) []PaperRule {
+	rules, err := ParsePaperRules(os.Getenv(key))
+	if err != nil {
+		log.Printf("CONFIG: %s: %s, using default rules only", key, err)
+		return nil
+	}
+
+	return rules
+}
+
+// WebhookConfig configures a webhook publisher. The URL is read from
+// URLFile if URL is empty.
+type WebhookConfig struct {
+	URL     string
+	URLFile string
+}
+
+// EnvWebhooks returns the configuration of the webhook publishers among
+// publishers, read from <PREFIX>_WEBHOOK_URL and <PREFIX>_WEBHOOK_URL_FILE
+// where the prefix is given by WebhookEnv.
+func EnvWebhooks(publishers []string) map[string]WebhookConfig {
+	webhooks := make(map[string]WebhookConfig)
+	for _, name := range publishers {
+		if _, _, ok := ParseWebhook(name); !ok {
+			continue
+		}
+		prefix := WebhookEnv(name)
+		webhooks[strings.ToLower(name)] = WebhookConfig{
+			URL:     os.Getenv(prefix + "_WEBHOOK_URL"),
+			URLFile: os.Getenv(prefix + "_WEBHOOK_URL_FILE"),
+		}
+	}
+
+	return webhooks
+}
+
+// EnvMarkers returns the environment variable key parsed with
+// mdlinks.ParseMarkers. If the variable can not be parsed no markers are
+// returned.
+func EnvMarkers(key string) []mdlinks.Marker {
+	markers, err := mdlinks.ParseMarkers(os.Getenv(key))
+	if err != nil {
+		log.Printf("CONFIG: %s: %s, using default markers only", key, err)
+		return nil
+	}
+
+	return markers
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Setenv("BLOB_STYLE", "")
+	t.Setenv("LINK_PREFERENCE", "")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BlobStyle != BlobViewer {
+		t.Errorf("BlobStyle = %q, want %q", config.BlobStyle, BlobViewer)
+	}
+	if config.LinkForm != FormMirror {
+		t.Errorf("LinkForm = %q, want %q", config.LinkForm, FormMirror)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{"BLOB_STYLE", "rawest"},
+		{"LINK_PREFERENCE", "mirrored"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			t.Setenv(test.key, test.value)
+
+			config, err := LoadConfig()
+			if err == nil {
+				t.Fatalf("LoadConfig() = %+v, want an error", config)
+			}
+			if !strings.Contains(err.Error(), test.key) || !strings.Contains(err.Error(), `"`+test.value+`"`) {
+				t.Errorf("LoadConfig() error = %q, want it to name %s=%q", err, test.key, test.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/imwally/love-a-paper/mdlinks"
+	"github.com/imwally/love-a-paper/pdfmeta"
+)
+
+// PaperEntry is a paper as listed in a README: usually a list item linking
+// to the paper, often with PWL's scroll linking to a copy kept in the
+// repository, followed by the authors and year, a description and nested
+// bullets linking to talks and other related material.
+type PaperEntry struct {
+	Title string
+
+	// URL is the entry's primary link and Mirror the copy of the paper
+	// hosted in the repository. Either may be empty. Kind and MirrorKind
+	// are empty if the link is not recognised as a paper.
+	URL        string
+	Kind       PaperKind
+	Mirror     string
+	MirrorKind PaperKind
+
+	// Byline is the text naming the authors and year, from which Authors
+	// and Year are read. Description is the rest of the entry's text.
+	Byline      string
+	Description string
+	Authors     []string
+	Year        int
+
+	// Children are the links of the entry's nested bullets, resolved
+	// against the README.
+	Children []mdlinks.Link
+
+	Annotations []mdlinks.Annotation
+	Topic       string
+	Subtopic    string
+	ReadmePath  string
+	Permalink   string
+}
+
+// LinkForm is which of an entry's links a post uses.
+type LinkForm string
+
+const (
+	// FormMirror posts the copy hosted in the repository.
+	FormMirror LinkForm = "mirror"
+
+	// FormExternal posts the entry's primary link.
+	FormExternal LinkForm = "external"
+
+	// FormBoth posts the primary link and the mirror.
+	FormBoth LinkForm = "both"
+)
+
+// ParseLinkForm returns the LinkForm named by s.
+func ParseLinkForm(s string) (LinkForm, error) {
+	switch form := LinkForm(strings.ToLower(strings.TrimSpace(s))); form {
+	case FormMirror, FormExternal, FormBoth:
+		return form, nil
+	}
+
+	return "", fmt.Errorf("unknown link preference %q, want %q, %q or %q", s, FormMirror, FormExternal, FormBoth)
+}
+
+// Papers returns the papers the entry can be posted as, the one in the
+// preferred form first and the other forms after it as fallbacks. Only
+// links recognised as papers are posted, so an entry with a single paper
+// link has a single form.
+func (e *PaperEntry) Papers(prefer LinkForm) []*Paper {
+	var order []LinkForm
+	switch prefer {
+	case FormExternal:
+		order = []LinkForm{FormExternal, FormMirror}
+	case FormBoth:
+		order = []LinkForm{FormBoth, FormMirror, FormExternal}
+	default:
+		order = []LinkForm{FormMirror, FormExternal}
+	}
+
+	var papers []*Paper
+	for _, form := range order {
+		if paper := e.paper(form); paper != nil {
+			papers = append(papers, paper)
+		}
+	}
+
+	return papers
+}
+
+// paper returns the entry posted in form, or nil if the entry has no paper
+// link for it.
+func (e *PaperEntry) paper(form LinkForm) *Paper {
+	paper := &Paper{
+		Name:        e.Title,
+		Form:        form,
+		Topic:       e.Topic,
+		Subtopic:    e.Subtopic,
+		ReadmePath:  e.ReadmePath,
+		Permalink:   e.Permalink,
+		Annotations: e.Annotations,
+		Authors:     e.Authors,
+		Year:        e.Year,
+		Sources:     FieldSources{Name: SourceReadme},
+	}
+	if len(e.Authors) > 0 {
+		paper.Sources.Authors = SourceReadme
+	}
+	if e.Year != 0 {
+		paper.Sources.Year = SourceReadme
+	}
+
+	switch form {
+	case FormMirror:
+		if e.MirrorKind == "" {
+			return nil
+		}
+		paper.URL, paper.Kind = e.Mirror, e.MirrorKind
+	case FormExternal:
+		if e.Kind == "" {
+			return nil
+		}
+		paper.URL, paper.Kind = e.URL, e.Kind
+	case FormBoth:
+		if e.Kind == "" || e.MirrorKind == "" {
+			return nil
+		}
+		paper.URL, paper.Kind = e.URL, e.Kind
+		paper.Mirror = e.Mirror
+	default:
+		return nil
+	}
+
+	return paper
+}
+
+// Key identifies the entry within a catalog.
+func (e *PaperEntry) Key() string {
+	return e.Permalink + " " + e.URL + " " + e.Mirror
+}
+
+var (
+	// bylineYear matches text up to and including a year, and the
+	// parenthesis closing it.
+	bylineYear = regexp.MustCompile(`^.*?\b(1[89]\d\d|20\d\d)\b\)?`)
+
+	// bylineEtAl matches text up to and including "et al.".
+	bylineEtAl = regexp.MustCompile(`^.*?\bet al\b\.?`)
+
+	// year matches a year in a byline.
+	year = regexp.MustCompile(`\b(1[89]\d\d|20\d\d)\b`)
+)
+
+// separators are trimmed from around bylines and descriptions.
+const separators = " \t-–—:;,."
+
+// ParseByline splits the text of an entry into the byline naming its
+// authors and year and the description that follows. A byline either
+// starts with "by" or ends at the first year or "et al." of the text's
+// first sentence; text with none of them has no byline.
+func ParseByline(text string) (byline, description string) {
+	text = strings.Trim(text, separators)
+
+	sentence := text
+	if end := strings.Index(text, ". "); end >= 0 {
+		sentence = text[:end]
+	}
+
+	if m := bylineYear.FindString(sentence); m != "" {
+		return strings.Trim(m, separators), strings.Trim(text[len(m):], separators)
+	}
+	if m := bylineEtAl.FindString(sentence); m != "" {
+		return strings.Trim(m, separators), strings.Trim(text[len(m):], separators)
+	}
+	if strings.HasPrefix(strings.ToLower(text), "by ") {
+		return strings.Trim(sentence, separators), strings.Trim(text[len(sentence):], separators)
+	}
+
+	return "", text
+}
+
+// BylineAuthors returns the authors named in byline. Names must start with
+// a capital letter, so bylines like "published in 1978" name no one.
+func BylineAuthors(byline string) []string {
+	byline = strings.TrimSpace(byline)
+	if strings.HasPrefix(strings.ToLower(byline), "by ") {
+		byline = byline[3:]
+	}
+	byline = year.ReplaceAllString(byline, "")
+	byline = strings.NewReplacer(",", ";", "(", "", ")", "", " et al.", "", " et al", "").Replace(byline)
+
+	var authors []string
+	for _, author := range pdfmeta.SplitAuthors(byline) {
+		author = strings.Trim(author, separators)
+		if author == "" {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(author); !unicode.IsUpper(r) {
+			return nil
+		}
+		authors = append(authors, author)
+	}
+
+	return authors
+}
+
+// itemEntries returns the paper entries of items. A list item with paper
+// links is a single entry, with its nested bullets as children; the
+// children of a list item without any are searched for entries instead.
+// Every paper link of a paragraph is an entry of its own.
+func (ix *Indexer) itemEntries(readmeURL *url.URL, readmePath string, items []mdlinks.Item) []PaperEntry {
+	var entries []PaperEntry
+	for _, item := range items {
+		if !item.List {
+			for i := range item.Links {
+				single := item
+				single.Links = item.Links[i : i+1]
+				single.Line = item.Links[i].Line
+				single.Headings = item.Links[i].Headings
+				single.Prose = ""
+				if entry, ok := ix.entry(readmeURL, readmePath, single); ok {
+					entries = append(entries, entry)
+				}
+			}
+			continue
+		}
+
+		if entry, ok := ix.entry(readmeURL, readmePath, item); ok {
+			entries = append(entries, entry)
+			continue
+		}
+		entries = append(entries, ix.itemEntries(readmeURL, readmePath, item.Children)...)
+	}
+
+	return entries
+}
+
+// entry returns the paper entry of item. It returns false if none of the
+// item's links is a paper or the item is in a skipped section.
+func (ix *Indexer) entry(readmeURL *url.URL, readmePath string, item mdlinks.Item) (PaperEntry, bool) {
+	if ix.skipped(item.Headings) {
+		return PaperEntry{}, false
+	}
+
+	entry := PaperEntry{
+		Topic:      TopicName(path.Dir(readmePath)),
+		Subtopic:   Subtopic(item.Headings),
+		ReadmePath: readmePath,
+		Permalink:  ix.Permalink(readmePath, item.Line),
+	}
+
+	primary, mirror := -1, -1
+	for i, link := range item.Links {
+		location, err := ix.Resolver.Resolve(readmeURL, link.Location)
+		if err != nil {
+			continue
+		}
+		kind, _ := ix.Classifier.Classify(location)
+
+		if ix.selfHosted(&link, location) {
+			if mirror < 0 {
+				mirror = i
+				entry.Mirror, entry.MirrorKind = location, kind
+			}
+			continue
+		}
+		if primary < 0 || (entry.Kind == "" && kind != "") {
+			primary = i
+			entry.URL, entry.Kind = location, kind
+		}
+	}
+	if entry.Kind == "" && entry.MirrorKind == "" {
+		return PaperEntry{}, false
+	}
+
+	if primary >= 0 && item.Links[primary].Name != "" {
+		entry.Title = item.Links[primary].Name
+	} else if mirror >= 0 {
+		entry.Title = LinkName(item.Links, mirror, entry.Mirror)
+	} else {
+		entry.Title = LinkName(item.Links, primary, entry.URL)
+	}
+
+	for _, link := range item.Links {
+		for _, a := range link.Annotations {
+			if !hasAnnotation(entry.Annotations, a) {
+				entry.Annotations = append(entry.Annotations, a)
+			}
+		}
+	}
+
+	entry.Byline, entry.Description = ParseByline(item.Prose)
+	entry.Authors = BylineAuthors(entry.Byline)
+	entry.Year = pdfmeta.ParseYear(entry.Byline)
+	entry.Children = ix.children(readmeURL, item.Children)
+
+	return entry, true
+}
+
+// children returns the links of items and their children, resolved against
+// readmeURL.
+func (ix *Indexer) children(readmeURL *url.URL, items []mdlinks.Item) []mdlinks.Link {
+	var links []mdlinks.Link
+	for _, item := range items {
+		for _, link := range item.Links {
+			if location, err := ix.Resolver.Resolve(readmeURL, link.Location); err == nil {
+				link.Location = location
+			}
+			links = append(links, link)
+		}
+		links = append(links, ix.children(readmeURL, item.Children)...)
+	}
+
+	return links
+}
+
+// selfHosted returns true if link points at a copy of a paper kept in the
+// repository: it is marked as self hosted, relative, or a Github link into
+// the repository.
+func (ix *Indexer) selfHosted(link *mdlinks.Link, location string) bool {
+	if link.Has(mdlinks.SelfHosted) {
+		return true
+	}
+	if u, err := url.Parse(link.Location); err == nil && !u.IsAbs() && u.Host == "" && u.Path != "" {
+		return true
+	}
+
+	for _, host := range []string{"github.com", "raw.githubusercontent.com"} {
+		prefix := "https://" + host + "/" + ix.Owner + "/" + ix.Repo + "/"
+		if strings.HasPrefix(strings.ToLower(location), strings.ToLower(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasAnnotation(annotations []mdlinks.Annotation, a mdlinks.Annotation) bool {
+	for _, annotation := range annotations {
+		if annotation == a {
+			return true
+		}
+	}
+
+	return false
+}
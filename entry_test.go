@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseByline(t *testing.T) {
+	tests := []struct {
+		text        string
+		byline      string
+		description string
+		authors     []string
+	}{
+		{"by A and B, 2014", "by A and B, 2014", "", []string{"A", "B"}},
+		{"A et al.", "A et al", "", []string{"A"}},
+		{"Ongaro et al., 2014 - the Raft paper", "Ongaro et al., 2014", "the Raft paper", []string{"Ongaro"}},
+		{"Lamport et al. Still worth reading.", "Lamport et al", "Still worth reading", []string{"Lamport"}},
+		{"- Leslie Lamport, 2001. The classic.", "Leslie Lamport, 2001", "The classic", []string{"Leslie Lamport"}},
+		{"Jim Gray & Andreas Reuter (1992)", "Jim Gray & Andreas Reuter (1992)", "", []string{"Jim Gray", "Andreas Reuter"}},
+		{"by Ongaro and Ousterhout. Great read", "by Ongaro and Ousterhout", "Great read", []string{"Ongaro", "Ousterhout"}},
+		{"published in 1978", "published in 1978", "", nil},
+		{"A survey of consensus", "", "A survey of consensus", nil},
+		{"", "", "", nil},
+	}
+
+	for _, test := range tests {
+		byline, description := ParseByline(test.text)
+		if byline != test.byline || description != test.description {
+			t.Errorf("ParseByline(%q) = %q, %q, want %q, %q", test.text, byline, description, test.byline, test.description)
+		}
+		if authors := BylineAuthors(byline); !reflect.DeepEqual(authors, test.authors) {
+			t.Errorf("BylineAuthors(%q) = %q, want %q", byline, authors, test.authors)
+		}
+	}
+}
+
+func TestReadmeEntries(t *testing.T) {
+	const readme = `# Distributed Systems
+
+* [Paxos Made Simple](https://example.org/paxos.pdf) [:scroll:](paxos.pdf) by Leslie Lamport, 2001. The classic.
+  * [Talk](https://www.youtube.com/watch?v=1)
+  * [Slides](https://example.org/slides.pdf)
+* Related
+  * [Raft](https://example.org/raft\_paper.pdf) - Ongaro et al., 2014
+
+## Other
+
+See also [Chubby](https://example.org/chubby.pdf) by Burrows, 2006.
+
+## External Papers
+
+* [Skipped](https://example.org/skipped.pdf)
+`
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "distributed_systems"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "distributed_systems", "README.md"), []byte(readme), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix := NewIndexer(NewLocalSource(dir), "papers-we-love", "papers-we-love", "master", time.Hour, SearchBudget{APICalls: 10})
+	ix.SkipSections = []string{"External Papers"}
+
+	entries, err := ix.readmeEntries("distributed_systems/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		Title, URL, Mirror, Byline, Description, Subtopic, Permalink string
+		Authors                                                      []string
+		Year                                                         int
+		Children                                                     []string
+	}
+	permalink := "https://github.com/papers-we-love/papers-we-love/blob/master/distributed_systems/README.md?plain=1#L"
+	want := []summary{
+		{
+			Title:       "Paxos Made Simple",
+			URL:         "https://example.org/paxos.pdf",
+			Mirror:      "https://github.com/papers-we-love/papers-we-love/blob/master/distributed_systems/paxos.pdf",
+			Byline:      "by Leslie Lamport, 2001",
+			Description: "The classic",
+			Permalink:   permalink + "3",
+			Authors:     []string{"Leslie Lamport"},
+			Year:        2001,
+			Children:    []string{"https://www.youtube.com/watch?v=1", "https://example.org/slides.pdf"},
+		},
+		{
+			Title:     "Raft",
+			URL:       "https://example.org/raft_paper.pdf",
+			Byline:    "Ongaro et al., 2014",
+			Permalink: permalink + "7",
+			Authors:   []string{"Ongaro"},
+			Year:      2014,
+		},
+		{
+			Title:     "Chubby",
+			URL:       "https://example.org/chubby.pdf",
+			Subtopic:  "Other",
+			Permalink: permalink + "11",
+		},
+	}
+
+	var got []summary
+	for _, entry := range entries {
+		s := summary{
+			Title:       entry.Title,
+			URL:         entry.URL,
+			Mirror:      entry.Mirror,
+			Byline:      entry.Byline,
+			Description: entry.Description,
+			Subtopic:    entry.Subtopic,
+			Permalink:   entry.Permalink,
+			Authors:     entry.Authors,
+			Year:        entry.Year,
+		}
+		for _, child := range entry.Children {
+			s.Children = append(s.Children, child.Location)
+		}
+		got = append(got, s)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestPaperEntryPapers(t *testing.T) {
+	const (
+		external = "https://example.org/paxos.pdf"
+		mirror   = "https://github.com/papers-we-love/papers-we-love/blob/master/distributed_systems/paxos.pdf"
+	)
+	both := PaperEntry{Title: "Paxos", URL: external, Kind: KindPDF, Mirror: mirror, MirrorKind: KindPDF}
+	externalOnly := PaperEntry{Title: "Paxos", URL: external, Kind: KindPDF}
+	mirrorOnly := PaperEntry{Title: "Paxos", URL: "https://example.org/paxos.html", Mirror: mirror, MirrorKind: KindPDF}
+
+	// A paper is summarised as its form, URL and mirror.
+	type paper struct {
+		Form        LinkForm
+		URL, Mirror string
+	}
+	tests := []struct {
+		name   string
+		entry  PaperEntry
+		prefer LinkForm
+		want   []paper
+	}{
+		{"mirror preferred", both, FormMirror, []paper{
+			{FormMirror, mirror, ""},
+			{FormExternal, external, ""},
+		}},
+		{"external preferred", both, FormExternal, []paper{
+			{FormExternal, external, ""},
+			{FormMirror, mirror, ""},
+		}},
+		{"both preferred", both, FormBoth, []paper{
+			{FormBoth, external, mirror},
+			{FormMirror, mirror, ""},
+			{FormExternal, external, ""},
+		}},
+		{"unset preference", both, "", []paper{
+			{FormMirror, mirror, ""},
+			{FormExternal, external, ""},
+		}},
+		{"mirror missing", externalOnly, FormMirror, []paper{
+			{FormExternal, external, ""},
+		}},
+		{"both without a mirror", externalOnly, FormBoth, []paper{
+			{FormExternal, external, ""},
+		}},
+		{"external not a paper", mirrorOnly, FormExternal, []paper{
+			{FormMirror, mirror, ""},
+		}},
+		{"both without a paper link", mirrorOnly, FormBoth, []paper{
+			{FormMirror, mirror, ""},
+		}},
+		{"no paper links", PaperEntry{Title: "Paxos", URL: "https://example.org/paxos.html"}, FormMirror, nil},
+	}
+
+	for _, test := range tests {
+		var got []paper
+		for _, p := range test.entry.Papers(test.prefer) {
+			got = append(got, paper{p.Form, p.URL, p.Mirror})
+			if p.Name != test.entry.Title {
+				t.Errorf("%s: paper name = %q, want %q", test.name, p.Name, test.entry.Title)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Papers(%q) = %+v, want %+v", test.name, test.prefer, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FeedItem is a posted paper in the feed.
+type FeedItem struct {
+	// GUID identifies the item for good, whatever else changes.
+	GUID       string    `json:"guid"`
+	Title      string    `json:"title"`
+	Link       string    `json:"link"`
+	Categories []string  `json:"categories,omitempty"`
+	Summary    string    `json:"summary,omitempty"`
+	Published  time.Time `json:"published"`
+}
+
+// NewFeedItem returns the feed item for paper posted at published. The GUID
+// is a tag URI made from the time it was posted and its link, so a paper
+// posted again gets an item of its own.
+func NewFeedItem(paper *Paper, published time.Time) FeedItem {
+	published = published.UTC()
+	sum := sha256.Sum256([]byte(paper.URL))
+
+	summary := fmt.Sprintf("%s (%s)", paper.Name, paper.Kind)
+	if byline := PaperByline(paper); byline != "" {
+		summary += " by " + byline
+	}
+	if paper.Mirror != "" {
+		summary += ". Mirror: " + paper.Mirror
+	}
+
+	return FeedItem{
+		GUID:       fmt.Sprintf("tag:love-a-paper,%s:%s/%s", published.Format("2006-01-02"), published.Format("150405.000000000"), hex.EncodeToString(sum[:8])),
+		Title:      paper.Name,
+		Link:       paper.URL,
+		Categories: paper.Hashtags(),
+		Summary:    summary,
+		Published:  published,
+	}
+}
+
+// FeedStore keeps the feed items as JSON lines in a file.
+type FeedStore struct {
+	Path string
+
+	// MaxItems is how many of the newest items the feeds show.
+	MaxItems int
+
+	mu sync.Mutex
+}
+
+// NewFeedStore returns a FeedStore stored at path whose feeds show the
+// newest maxItems items.
+func NewFeedStore(path string, maxItems int) *FeedStore {
+	return &FeedStore{Path: path, MaxItems: maxItems}
+}
+
+// Add appends item to the store.
+func (s *FeedStore) Add(item FeedItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Items returns the newest MaxItems items, newest first. A missing store is
+// empty.
+func (s *FeedStore) Items() ([]FeedItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []FeedItem
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var item FeedItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	if s.MaxItems > 0 && len(items) > s.MaxItems {
+		items = items[:s.MaxItems]
+	}
+
+	return items, nil
+}
+
+// FeedInfo describes the feed itself. URL is where the feeds are served
+// from, without a trailing slash.
+type FeedInfo struct {
+	Title       string
+	Description string
+	URL         string
+}
+
+// Feed file names, relative to FeedInfo.URL.
+const (
+	AtomFile = "atom.xml"
+	RSSFile  = "rss.xml"
+)
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   string      `xml:"author>name"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+// Atom returns the items as an Atom 1.0 feed.
+func Atom(info FeedInfo, items []FeedItem) ([]byte, error) {
+	feed := &atomFeed{
+		Title:    info.Title,
+		Subtitle: info.Description,
+		ID:       info.URL + "/" + AtomFile,
+		Updated:  feedUpdated(items).Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: info.URL + "/" + AtomFile},
+			{Rel: "alternate", Href: info.URL + "/"},
+		},
+		Author: info.Title,
+	}
+	for _, item := range items {
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        item.GUID,
+			Link:      atomLink{Href: item.Link},
+			Published: item.Published.Format(time.RFC3339),
+			Updated:   item.Published.Format(time.RFC3339),
+			Summary:   item.Summary,
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshalFeed(feed)
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description,omitempty"`
+}
+
+type rssFeed struct {
+	XMLName       xml.Name  `xml:"rss"`
+	Version       string    `xml:"version,attr"`
+	Title         string    `xml:"channel>title"`
+	Link          string    `xml:"channel>link"`
+	Description   string    `xml:"channel>description"`
+	LastBuildDate string    `xml:"channel>lastBuildDate"`
+	Items         []rssItem `xml:"channel>item"`
+}
+
+// RSS returns the items as an RSS 2.0 feed.
+func RSS(info FeedInfo, items []FeedItem) ([]byte, error) {
+	description := info.Description
+	if description == "" {
+		description = info.Title
+	}
+
+	feed := &rssFeed{
+		Version:       "2.0",
+		Title:         info.Title,
+		Link:          info.URL + "/",
+		Description:   description,
+		LastBuildDate: feedUpdated(items).Format(time.RFC1123Z),
+	}
+	for _, item := range items {
+		feed.Items = append(feed.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{Value: item.GUID},
+			PubDate:     item.Published.Format(time.RFC1123Z),
+			Categories:  item.Categories,
+			Description: item.Summary,
+		})
+	}
+
+	return marshalFeed(feed)
+}
+
+// feedUpdated returns when the newest of items was published, or the Unix
+// epoch for an empty feed.
+func feedUpdated(items []FeedItem) time.Time {
+	if len(items) == 0 {
+		return time.Unix(0, 0).UTC()
+	}
+
+	return items[0].Published
+}
+
+func marshalFeed(feed interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// feedRenderers maps the feed files to their renderers and content types.
+var feedRenderers = map[string]struct {
+	render      func(FeedInfo, []FeedItem) ([]byte, error)
+	contentType string
+}{
+	AtomFile: {Atom, "application/atom+xml; charset=utf-8"},
+	RSSFile:  {RSS, "application/rss+xml; charset=utf-8"},
+}
+
+// FeedHandler serves the store's feeds at /atom.xml and /rss.xml.
+func FeedHandler(store *FeedStore, info FeedInfo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renderer, ok := feedRenderers[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		items, err := store.Items()
+		if err != nil {
+			log.Printf("FEED: %s", err)
+			http.Error(w, "feed unavailable", http.StatusInternalServerError)
+			return
+		}
+		data, err := renderer.render(info, items)
+		if err != nil {
+			log.Printf("FEED: %s", err)
+			http.Error(w, "feed unavailable", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", renderer.contentType)
+		http.ServeContent(w, r, "", feedUpdated(items), bytes.NewReader(data))
+	})
+}
+
+// WriteFeeds writes the store's feeds to atom.xml and rss.xml in dir.
+func WriteFeeds(store *FeedStore, info FeedInfo, dir string) error {
+	items, err := store.Items()
+	if err != nil {
+		return err
+	}
+
+	for name, renderer := range feedRenderers {
+		data, err := renderer.render(info, items)
+		if err != nil {
+			return err
+		}
+
+		tmp, err := ioutil.TempFile(dir, "."+name)
+		if err != nil {
+			return err
+		}
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := os.Chmod(tmp.Name(), 0644); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var testFeedInfo = FeedInfo{
+	Title:       "Love a Paper",
+	Description: "Papers from Papers We Love",
+	URL:         "https://feeds.example.org",
+}
+
+// testFeedItems are two posted papers, newest first.
+func testFeedItems() []FeedItem {
+	raft := &Paper{
+		Name:     "In Search of an Understandable Consensus Algorithm",
+		URL:      "https://raft.github.io/raft.pdf",
+		Kind:     KindPDF,
+		Topic:    "DistributedSystems",
+		Subtopic: "Consensus",
+		Authors:  []string{"Diego Ongaro", "John Ousterhout"},
+		Year:     2014,
+	}
+	paxos := &Paper{
+		Name:   "Paxos Made Simple & <Fast>",
+		URL:    "https://example.org/paxos.pdf?a=1&b=2",
+		Mirror: "https://github.com/papers-we-love/papers-we-love/blob/master/distributed_systems/paxos.pdf",
+		Form:   FormBoth,
+		Kind:   KindPDF,
+		Topic:  "DistributedSystems",
+	}
+
+	return []FeedItem{
+		NewFeedItem(raft, time.Date(2024, 3, 2, 15, 4, 5, 0, time.UTC)),
+		NewFeedItem(paxos, time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("EST", -5*3600))),
+	}
+}
+
+// checkGolden compares got with testdata/name, or rewrites it with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+// TestFeeds checks the Atom and RSS feeds of testFeedItems against
+// testdata/feed.atom.golden and testdata/feed.rss.golden, and those of no
+// items against testdata/empty.*.golden. Run with -update to rewrite them.
+func TestFeeds(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		items []FeedItem
+	}{
+		{"feed", testFeedItems()},
+		{"empty", nil},
+	} {
+		atom, err := Atom(testFeedInfo, test.items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, test.name+".atom.golden", atom)
+
+		rss, err := RSS(testFeedInfo, test.items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, test.name+".rss.golden", rss)
+	}
+}
+
+func TestFeedStoreMaxItems(t *testing.T) {
+	store := NewFeedStore(filepath.Join(t.TempDir(), "feed.jsonl"), 3)
+	items, err := store.Items()
+	if err != nil || len(items) != 0 {
+		t.Fatalf("Items() of a missing store = %+v, %v, want none", items, err)
+	}
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		paper := &Paper{Name: fmt.Sprintf("Paper %d", i), URL: fmt.Sprintf("https://example.org/%d.pdf", i), Kind: KindPDF, Topic: "consensus"}
+		if err := store.Add(NewFeedItem(paper, start.Add(time.Duration(i)*time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err = store.Items()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, item.Title)
+	}
+	if want := "[Paper 4 Paper 3 Paper 2]"; fmt.Sprint(got) != want {
+		t.Errorf("Items() = %s, want the newest 3, %s", got, want)
+	}
+
+	store.MaxItems = 0
+	if items, err := store.Items(); err != nil || len(items) != 5 {
+		t.Errorf("Items() without a limit = %d items, %v, want all 5", len(items), err)
+	}
+}
+
+func TestFeedHandler(t *testing.T) {
+	store := NewFeedStore(filepath.Join(t.TempDir(), "feed.jsonl"), 10)
+	items := testFeedItems()
+	for i := len(items) - 1; i >= 0; i-- {
+		if err := store.Add(items[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(FeedHandler(store, testFeedInfo))
+	defer server.Close()
+
+	atom, err := Atom(testFeedInfo, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rss, err := RSS(testFeedInfo, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		body        []byte
+	}{
+		{"/atom.xml", http.StatusOK, "application/atom+xml; charset=utf-8", atom},
+		{"/rss.xml", http.StatusOK, "application/rss+xml; charset=utf-8", rss},
+		{"/", http.StatusNotFound, "", nil},
+		{"/feed.jsonl", http.StatusNotFound, "", nil},
+		{"/atom.xml/", http.StatusNotFound, "", nil},
+		{"/ATOM.XML", http.StatusNotFound, "", nil},
+	}
+
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s: status %d, want %d", test.path, resp.StatusCode, test.status)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		if got := resp.Header.Get("Content-Type"); got != test.contentType {
+			t.Errorf("GET %s: Content-Type %q, want %q", test.path, got, test.contentType)
+		}
+		if string(body) != string(test.body) {
+			t.Errorf("GET %s: body\n%s\nwant\n%s", test.path, body, test.body)
+		}
+		if got := resp.Header.Get("Last-Modified"); got != items[0].Published.Format(http.TimeFormat) {
+			t.Errorf("GET %s: Last-Modified %q, want the newest item's time", test.path, got)
+		}
+	}
+
+	req, err := http.NewRequest("GET", server.URL+"/atom.xml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-Modified-Since", items[0].Published.Format(http.TimeFormat))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional GET: status %d, want %d", resp.StatusCode, http.StatusNotModified)
+	}
+}
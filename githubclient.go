@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// MinAPICalls is the fewest remaining Github API requests worth starting a
+// catalog build with: one to list the tree and one to read a README.
+const MinAPICalls = 2
+
+// TokenTransport is an http.RoundTripper that authenticates every request
+// with a Github personal access token.
+type TokenTransport struct {
+	Token string
+
+	// Transport is the underlying RoundTripper. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// RoundTrip adds the Authorization header to a copy of req and sends it.
+func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	r.Header.Set("Authorization", "token "+t.Token)
+
+	return t.transport().RoundTrip(r)
+}
+
+func (t *TokenTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+
+	return http.DefaultTransport
+}
+
+// GithubToken returns the Github API token from the configuration. A token
+// set directly takes precedence over one read from a file.
+func GithubToken(config *Config) (string, error) {
+	return SecretValue(config.GithubToken, config.GithubTokenFile)
+}
+
+// SecretValue returns value if it is set and otherwise the trimmed content
+// of file, if one is named.
+func SecretValue(value, file string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if file == "" {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// NewGithubClient returns a Github client sending requests through
+// transport, authenticated if the configuration holds a token and anonymous
+// otherwise. A nil transport uses http.DefaultTransport.
+func NewGithubClient(config *Config, transport http.RoundTripper) (*github.Client, error) {
+	token, err := GithubToken(config)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		log.Printf("GITHUB: no token configured, using anonymous requests")
+	} else {
+		transport = &TokenTransport{Token: token, Transport: transport}
+	}
+	if transport == nil {
+		return github.NewClient(nil), nil
+	}
+
+	return github.NewClient(&http.Client{Transport: transport}), nil
+}
+
+// LogRate logs the rate limit reported by a Github API response. resp may be
+// nil, as it is when a request fails before a response is received.
+func LogRate(resp *github.Response) {
+	if resp == nil || resp.Response == nil {
+		return
+	}
+	log.Printf("GITHUB: %d of %d API requests remaining, reset at %s.", resp.Remaining, resp.Limit, resp.Reset)
+}
+
+// CoreRate returns the client's current core API rate limit.
+func CoreRate(client *github.Client) (*github.Rate, error) {
+	limits, resp, err := client.RateLimits()
+	LogRate(resp)
+	if err != nil {
+		return nil, err
+	}
+	if limits == nil || limits.Core == nil {
+		return nil, errors.New("no core rate limit reported")
+	}
+
+	return limits.Core, nil
+}
+
+// RateLimitReset returns the time the rate limit that caused err resets. It
+// returns false if err was not caused by the rate limit.
+func RateLimitReset(err error) (time.Time, bool) {
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		return e.Rate.Reset.Time, true
+	case *SearchError:
+		if e.Reason != RateLimited {
+			return time.Time{}, false
+		}
+		if !e.Reset.IsZero() {
+			return e.Reset, true
+		}
+		return RateLimitReset(e.Err)
+	}
+
+	return time.Time{}, false
+}
+
+// RateLimitedError returns a SearchError for a rate limit that will not
+// allow another request until reset.
+func RateLimitedError(rate *github.Rate) error {
+	return &SearchError{
+		Reason: RateLimited,
+		Reset:  rate.Reset.Time,
+		Err:    fmt.Errorf("%d of %d API requests remaining", rate.Remaining, rate.Limit),
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// newTestGithubClient returns a Github client configured by config sending
+// its requests, through transport, to an httptest server running handler.
+func newTestGithubClient(t *testing.T, config *Config, handler http.Handler, transport http.RoundTripper) *github.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewGithubClient(config, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL, err = url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+// setRate sets the rate limit headers Github sends with every response.
+func setRate(w http.ResponseWriter, remaining int, reset time.Time) {
+	w.Header().Set("X-RateLimit-Limit", "60")
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(remaining))
+	w.Header().Set("X-RateLimit-Reset", fmt.Sprint(reset.Unix()))
+}
+
+func TestTokenTransport(t *testing.T) {
+	var got string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"resources": {"core": {"limit": 5000, "remaining": 5000}}}`)
+	})
+	client := newTestGithubClient(t, &Config{GithubToken: "secret"}, handler, nil)
+
+	if _, err := CoreRate(client); err != nil {
+		t.Fatal(err)
+	}
+	if got != "token secret" {
+		t.Errorf("Authorization = %q, want %q", got, "token secret")
+	}
+}
+
+func TestIndexerRateLimitBeforeBuild(t *testing.T) {
+	reset := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	var requests []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		setRate(w, 1, reset)
+		fmt.Fprintf(w, `{"resources": {"core": {"limit": 60, "remaining": 1, "reset": %d}}}`, reset.Unix())
+	})
+	client := newTestGithubClient(t, &Config{}, handler, nil)
+
+	source := NewGithubSource(client, "papers-we-love", "papers-we-love", "master")
+	ix := NewIndexer(source, "papers-we-love", "papers-we-love", "master", time.Hour, SearchBudget{APICalls: 10})
+	_, err := ix.Build()
+	if !IsRateLimit(err) {
+		t.Fatalf("Build() error = %v, want a rate limit error", err)
+	}
+	if got, ok := RateLimitReset(err); !ok || !got.Equal(reset) {
+		t.Errorf("RateLimitReset() = %s, %t, want %s, true", got, ok, reset)
+	}
+	if len(requests) != 1 || requests[0] != "/rate_limit" {
+		t.Errorf("requests = %q, want only /rate_limit", requests)
+	}
+}
+
+func TestIndexerRateLimitExceeded(t *testing.T) {
+	reset := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rate_limit" {
+			setRate(w, 60, reset)
+			fmt.Fprintf(w, `{"resources": {"core": {"limit": 60, "remaining": 60, "reset": %d}}}`, reset.Unix())
+			return
+		}
+		setRate(w, 0, reset)
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "API rate limit exceeded for 192.0.2.1."}`)
+	})
+	client := newTestGithubClient(t, &Config{}, handler, nil)
+
+	source := NewGithubSource(client, "papers-we-love", "papers-we-love", "master")
+	ix := NewIndexer(source, "papers-we-love", "papers-we-love", "master", time.Hour, SearchBudget{APICalls: 10})
+	_, err := ix.Build()
+	if !IsRateLimit(err) {
+		t.Fatalf("Build() error = %v, want a rate limit error", err)
+	}
+	if got, ok := RateLimitReset(err); !ok || !got.Equal(reset) {
+		t.Errorf("RateLimitReset() = %s, %t, want %s, true", got, ok, reset)
+	}
+	if wait := SleepTime(err); wait < 30*time.Minute || wait > 32*time.Minute {
+		t.Errorf("SleepTime() = %s, want the time until the reset", wait)
+	}
+}
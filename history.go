@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// HistoryEntry records a posted paper.
+type HistoryEntry struct {
+	Time      time.Time    `json:"time"`
+	Name      string       `json:"name"`
+	URL       string       `json:"url"`
+	Mirror    string       `json:"mirror,omitempty"`
+	Form      LinkForm     `json:"form,omitempty"`
+	Kind      PaperKind    `json:"kind"`
+	Topic     string       `json:"topic"`
+	Permalink string       `json:"permalink,omitempty"`
+	Authors   []string     `json:"authors,omitempty"`
+	Year      int          `json:"year,omitempty"`
+	Sources   FieldSources `json:"sources"`
+	Publisher string       `json:"publisher,omitempty"`
+	PostID    string       `json:"post_id,omitempty"`
+	PostURL   string       `json:"post_url,omitempty"`
+}
+
+// NewHistoryEntry returns a HistoryEntry for paper posted now as postID.
+func NewHistoryEntry(paper *Paper, postID string) HistoryEntry {
+	return HistoryEntry{
+		Time:      time.Now().UTC(),
+		Name:      paper.Name,
+		URL:       paper.URL,
+		Mirror:    paper.Mirror,
+		Form:      paper.Form,
+		Kind:      paper.Kind,
+		Topic:     paper.Topic,
+		Permalink: paper.Permalink,
+		Authors:   paper.Authors,
+		Year:      paper.Year,
+		Sources:   paper.Sources,
+		PostID:    postID,
+	}
+}
+
+// History is a log of posted papers stored as JSON lines in a file.
+type History struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewHistory returns a History stored at path.
+func NewHistory(path string) *History {
+	return &History{Path: path}
+}
+
+// Record appends entry to the history.
+func (h *History) Record(entry HistoryEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(h.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Entries returns every entry in the history, oldest first. A missing
+// history file is an empty history.
+func (h *History) Entries() ([]HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.Open(h.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
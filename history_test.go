@@ -0,0 +1,39 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistorySources(t *testing.T) {
+	paper := &Paper{
+		Name:    "Paxos Made Simple",
+		URL:     "https://lamport.azurewebsites.net/pubs/paxos-simple.pdf",
+		Kind:    KindPDF,
+		Authors: []string{"Leslie Lamport"},
+		Year:    2001,
+		Sources: FieldSources{Name: "xmp", Authors: "pdf info", Year: SourceReadme},
+	}
+	history := NewHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err := history.Record(NewHistoryEntry(paper, "1")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := history.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if got := entries[0].Sources; got != paper.Sources {
+		t.Errorf("Sources = %+v, want %+v", got, paper.Sources)
+	}
+	if !reflect.DeepEqual(entries[0].Authors, paper.Authors) || entries[0].Year != paper.Year {
+		t.Errorf("got %v, %d, want %v, %d", entries[0].Authors, entries[0].Year, paper.Authors, paper.Year)
+	}
+	if got, want := paper.Sources.String(), "name from xmp, authors from pdf info, year from readme"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a response body stored on disk together with the
+// validators used to revalidate it.
+type CachedResponse struct {
+	URL          string
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	ETag         string
+	LastModified string
+	Stored       time.Time
+}
+
+// CacheTransport is an http.RoundTripper that caches GET responses on disk
+// and revalidates them with conditional requests. A 304 Not Modified, which
+// Github does not count against the rate limit, is answered from the cache.
+// Entries older than TTL are discarded and the cache directory is pruned,
+// oldest entries first, once it grows past MaxSize bytes.
+type CacheTransport struct {
+	Dir     string
+	MaxSize int64
+	TTL     time.Duration
+
+	// Transport is the underlying RoundTripper. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	mu     sync.Mutex
+	hits   int
+	misses int
+}
+
+// NewCacheTransport returns a CacheTransport storing responses in dir.
+func NewCacheTransport(dir string, maxSize int64, ttl time.Duration) *CacheTransport {
+	return &CacheTransport{
+		Dir:     dir,
+		MaxSize: maxSize,
+		TTL:     ttl,
+	}
+}
+
+// RoundTrip sends req, answering it from the cache when the server reports
+// the cached copy is still current.
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" || t.MaxSize <= 0 {
+		return t.transport().RoundTrip(req)
+	}
+
+	key := t.key(req)
+	cached := t.load(key)
+
+	r := req
+	if cached != nil {
+		r = new(http.Request)
+		*r = *req
+		r.Header = make(http.Header, len(req.Header))
+		for k, v := range req.Header {
+			r.Header[k] = append([]string(nil), v...)
+		}
+		if cached.ETag != "" {
+			r.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			r.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := t.transport().RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		t.count(true)
+		return cached.Response(req, resp.Header), nil
+	}
+	t.count(false)
+
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	t.store(key, &CachedResponse{
+		URL:          req.URL.String(),
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Body:         body,
+		ETag:         etag,
+		LastModified: lastModified,
+		Stored:       time.Now(),
+	})
+
+	return resp, nil
+}
+
+// Response rebuilds an http.Response for req from the cached copy. Rate
+// limit headers are taken from the fresh header so callers see the current
+// limit rather than the one at the time the response was cached.
+func (c *CachedResponse) Response(req *http.Request, fresh http.Header) *http.Response {
+	header := make(http.Header, len(c.Header))
+	for k, v := range c.Header {
+		header[k] = v
+	}
+	for k, v := range fresh {
+		if strings.HasPrefix(k, "X-Ratelimit-") {
+			header[k] = v
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.StatusCode, http.StatusText(c.StatusCode)),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (t *CacheTransport) Stats() (hits, misses int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.hits, t.misses
+}
+
+// LogStats logs the number of cache hits and misses so far.
+func (t *CacheTransport) LogStats() {
+	hits, misses := t.Stats()
+	log.Printf("CACHE: %d hits, %d misses", hits, misses)
+}
+
+func (t *CacheTransport) count(hit bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if hit {
+		t.hits++
+	} else {
+		t.misses++
+	}
+}
+
+func (t *CacheTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+
+	return http.DefaultTransport
+}
+
+// key returns the cache file name for req. The Authorization header is part
+// of the key so responses are never shared between credentials.
+func (t *CacheTransport) key(req *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(req.URL.String()))
+	h.Write([]byte{0})
+	h.Write([]byte(req.Header.Get("Accept")))
+	h.Write([]byte{0})
+	h.Write([]byte(req.Header.Get("Authorization")))
+
+	return hex.EncodeToString(h.Sum(nil)) + ".json"
+}
+
+// load returns the cached response stored under key, or nil if there is
+// none or it is older than the TTL.
+func (t *CacheTransport) load(key string) *CachedResponse {
+	p := filepath.Join(t.Dir, key)
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+
+	cached := &CachedResponse{}
+	if err := json.Unmarshal(data, cached); err != nil {
+		log.Printf("CACHE: removing corrupt entry %s: %s", key, err)
+		os.Remove(p)
+		return nil
+	}
+	if t.TTL > 0 && time.Since(cached.Stored) > t.TTL {
+		os.Remove(p)
+		return nil
+	}
+
+	return cached
+}
+
+// store writes cached under key and prunes the cache directory. Failures
+// are logged, a response that can not be cached is still returned.
+func (t *CacheTransport) store(key string, cached *CachedResponse) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		log.Printf("CACHE: %s", err)
+		return
+	}
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		log.Printf("CACHE: %s", err)
+		return
+	}
+
+	tmp, err := ioutil.TempFile(t.Dir, "tmp-")
+	if err != nil {
+		log.Printf("CACHE: %s", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(t.Dir, key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("CACHE: %s", err)
+		return
+	}
+
+	t.prune()
+}
+
+// prune removes the oldest cache entries until the directory is no larger
+// than MaxSize.
+func (t *CacheTransport) prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	infos, err := ioutil.ReadDir(t.Dir)
+	if err != nil {
+		return
+	}
+
+	var total int64
+	for _, info := range infos {
+		total += info.Size()
+	}
+	if total <= t.MaxSize {
+		return
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		if total <= t.MaxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(t.Dir, info.Name())); err == nil {
+			total -= info.Size()
+		}
+	}
+}
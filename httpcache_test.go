@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheTransportNotModified(t *testing.T) {
+	const etag = `"v1"`
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	remaining := 60
+	var conditional []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		remaining--
+		setRate(w, remaining, reset)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, `{"resources": {"core": {"limit": 60, "remaining": 59}}}`)
+	})
+	cache := NewCacheTransport(t.TempDir(), 1<<20, time.Hour)
+	client := newTestGithubClient(t, &Config{}, handler, cache)
+
+	for i := 0; i < 3; i++ {
+		limits, resp, err := client.RateLimits()
+		if err != nil {
+			t.Fatalf("request %d: %s", i, err)
+		}
+		if limits.Core == nil || limits.Core.Remaining != 59 {
+			t.Errorf("request %d: got cached body %+v, want the original", i, limits.Core)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("request %d: status = %d, want %d", i, resp.StatusCode, http.StatusOK)
+		}
+		if resp.Rate.Remaining != remaining {
+			t.Errorf("request %d: rate remaining = %d, want the fresh %d", i, resp.Rate.Remaining, remaining)
+		}
+	}
+
+	if want := []string{"", etag, etag}; fmt.Sprint(conditional) != fmt.Sprint(want) {
+		t.Errorf("If-None-Match headers = %q, want %q", conditional, want)
+	}
+	if hits, misses := cache.Stats(); hits != 2 || misses != 1 {
+		t.Errorf("Stats() = %d hits, %d misses, want 2, 1", hits, misses)
+	}
+}
+
+func TestCacheTransportModified(t *testing.T) {
+	version := 1
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, `{"content": %q, "encoding": "base64"}`, base64.StdEncoding.EncodeToString([]byte(etag)))
+	})
+	cache := NewCacheTransport(t.TempDir(), 1<<20, time.Hour)
+	client := newTestGithubClient(t, &Config{}, handler, cache)
+
+	read := func() string {
+		blob, _, err := client.Git.GetBlob("papers-we-love", "papers-we-love", "sha")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := base64.StdEncoding.DecodeString(*blob.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	if got := read(); got != `"v1"` {
+		t.Errorf("first read = %s, want v1", got)
+	}
+	version = 2
+	if got := read(); got != `"v2"` {
+		t.Errorf("read after change = %s, want v2", got)
+	}
+	if got := read(); got != `"v2"` {
+		t.Errorf("cached read = %s, want v2", got)
+	}
+	if hits, misses := cache.Stats(); hits != 1 || misses != 2 {
+		t.Errorf("Stats() = %d hits, %d misses, want 1, 2", hits, misses)
+	}
+}
+
+func TestCacheTransportExpired(t *testing.T) {
+	var conditional int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			conditional++
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "body")
+	})
+	dir := t.TempDir()
+	cache := NewCacheTransport(dir, 1<<20, time.Minute)
+	client := &http.Client{Transport: cache}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func() {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	get()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("cache holds %d entries (%v), want 1", len(infos), err)
+	}
+	cache.TTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	get()
+	if conditional != 0 {
+		t.Errorf("sent %d conditional requests for an expired entry, want 0", conditional)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultWaybackURL is the Wayback Machine availability API.
+const DefaultWaybackURL = "https://archive.org/wayback/available"
+
+// UserAgent is sent with every request the bot makes outside the Github API.
+const UserAgent = "love-a-paper (+https://github.com/imwally/love-a-paper)"
+
+// DeadLinkError is returned by LinkChecker.Check when a link is dead and no
+// archived copy of it exists.
+type DeadLinkError struct {
+	URL    string
+	Reason string
+}
+
+func (e *DeadLinkError) Error() string {
+	return fmt.Sprintf("%s is dead: %s", e.URL, e.Reason)
+}
+
+// LinkChecker checks that a paper link is alive before it is posted, falling
+// back to a Wayback Machine snapshot when it is not.
+type LinkChecker struct {
+	// WaybackURL is the base URL of the Wayback Machine availability API.
+	// If empty, dead links are never replaced by a snapshot.
+	WaybackURL string
+
+	client *http.Client
+}
+
+// NewLinkChecker returns a LinkChecker whose requests time out after
+// timeout.
+func NewLinkChecker(timeout time.Duration, waybackURL string) *LinkChecker {
+	return &LinkChecker{
+		WaybackURL: waybackURL,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Check returns the URL to post for a link of the given kind: the link
+// itself if it is alive, otherwise the closest archived snapshot. A
+// *DeadLinkError is returned if the link is dead and has no snapshot.
+func (c *LinkChecker) Check(link string, kind PaperKind) (string, error) {
+	reason := c.probe(link, kind)
+	if reason == "" {
+		return link, nil
+	}
+	log.Printf("INFO: %s is dead: %s", link, reason)
+
+	if c.WaybackURL == "" {
+		return "", &DeadLinkError{URL: link, Reason: reason}
+	}
+
+	snapshot, err := c.Snapshot(link)
+	if err != nil {
+		return "", &DeadLinkError{URL: link, Reason: fmt.Sprintf("%s, no snapshot: %s", reason, err)}
+	}
+	if snapshot == "" {
+		return "", &DeadLinkError{URL: link, Reason: reason + ", no snapshot"}
+	}
+	log.Printf("INFO: using snapshot %s", snapshot)
+
+	return snapshot, nil
+}
+
+// probe requests link and returns why it is dead, or an empty string if it
+// is alive. A HEAD request is tried first; servers that refuse HEAD are sent
+// a GET for the first byte only.
+func (c *LinkChecker) probe(link string, kind PaperKind) string {
+	resp, err := c.do("HEAD", link)
+	if err != nil || resp.StatusCode >= 400 {
+		resp, err = c.do("GET", link)
+	}
+	if err != nil {
+		return err.Error()
+	}
+
+	if resp.StatusCode >= 400 {
+		return resp.Status
+	}
+	if !AcceptsContentType(resp.Request.URL, kind, resp.Header.Get("Content-Type")) {
+		return "unexpected content type " + resp.Header.Get("Content-Type")
+	}
+
+	return ""
+}
+
+// do sends a request for link, discarding the body. GET requests ask for the
+// first byte only.
+func (c *LinkChecker) do(method, link string) (*http.Response, error) {
+	req, err := http.NewRequest(method, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if method == "GET" {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// AcceptsContentType returns true if contentType is plausible for a paper of
+// the given kind served from u. A link to a PDF or PostScript file that
+// answers with an HTML page, usually an error page or a publisher's home
+// page, is not accepted unless it is a Github file viewer page.
+func AcceptsContentType(u *url.URL, kind PaperKind, contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch kind {
+	case KindPDF, KindPostScript:
+		if mediaType != "text/html" {
+			return true
+		}
+		return u.Host == "github.com" && strings.Contains(u.Path, "/blob/")
+	}
+
+	return true
+}
+
+// waybackResponse is the part of the availability API response used.
+type waybackResponse struct {
+	ArchivedSnapshots struct {
+		Closest *struct {
+			Available bool   `json:"available"`
+			URL       string `json:"url"`
+			Status    string `json:"status"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// Snapshot returns the URL of the closest Wayback Machine snapshot of link,
+// or an empty string if there is none.
+func (c *LinkChecker) Snapshot(link string) (string, error) {
+	u, err := url.Parse(c.WaybackURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("url", link)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("wayback: %s", resp.Status)
+	}
+
+	var wr waybackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&wr); err != nil {
+		return "", err
+	}
+
+	closest := wr.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available || closest.URL == "" {
+		return "", nil
+	}
+	if closest.Status != "" && !strings.HasPrefix(closest.Status, "2") {
+		return "", nil
+	}
+
+	return closest.URL, nil
+}
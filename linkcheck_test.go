@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLinkCheckerCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/alive.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+	})
+	mux.HandleFunc("/no-head.pdf", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Range") != "bytes=0-0" {
+			t.Errorf("GET fallback sent Range %q, want bytes=0-0", r.Header.Get("Range"))
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.WriteHeader(http.StatusPartialContent)
+	})
+	mux.HandleFunc("/html.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	})
+	mux.HandleFunc("/archived.pdf", http.NotFound)
+	mux.HandleFunc("/lost.pdf", http.NotFound)
+	mux.HandleFunc("/wayback", func(w http.ResponseWriter, r *http.Request) {
+		link := r.URL.Query().Get("url")
+		if strings.HasSuffix(link, "/lost.pdf") {
+			fmt.Fprint(w, `{"archived_snapshots": {}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"archived_snapshots": {"closest": {"available": true, "status": "200", "url": "http://web.archive.org/web/2015/%s"}}}`, link)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	checker := NewLinkChecker(time.Second, server.URL+"/wayback")
+	tests := []struct {
+		path string
+		want string
+		dead bool
+	}{
+		{"/alive.pdf", server.URL + "/alive.pdf", false},
+		{"/no-head.pdf", server.URL + "/no-head.pdf", false},
+		{"/archived.pdf", "http://web.archive.org/web/2015/" + server.URL + "/archived.pdf", false},
+		{"/html.pdf", "http://web.archive.org/web/2015/" + server.URL + "/html.pdf", false},
+		{"/lost.pdf", "", true},
+	}
+	for _, test := range tests {
+		got, err := checker.Check(server.URL+test.path, KindPDF)
+		if _, ok := err.(*DeadLinkError); ok != test.dead {
+			t.Errorf("%s: error = %v, want dead %t", test.path, err, test.dead)
+		}
+		if got != test.want {
+			t.Errorf("%s: Check() = %q, want %q", test.path, got, test.want)
+		}
+	}
+
+	checker.WaybackURL = ""
+	if _, err := checker.Check(server.URL+"/archived.pdf", KindPDF); err == nil {
+		t.Error("dead link without a Wayback URL was accepted")
+	}
+}
@@ -1,36 +1,21 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
+	"fmt"
 	"log"
 	"math/big"
 	mrand "math/rand"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
-	"github.com/google/go-github/github"
 	"github.com/imwally/love-a-paper/mdlinks"
-	"github.com/kurrik/oauth1a"
-	"github.com/kurrik/twittergo"
 )
 
-// Readme holds the path to and content of the README file found in a github
-// repository directory.
-type Readme struct {
-	Path    string
-	Content string
-}
-
-// IsPDF returns true if the path has a .pdf extention. It is case insensitive.
-func IsPDF(path string) bool {
-	return strings.EqualFold(filepath.Ext(path), ".pdf")
-}
-
 // HasPrefix returns true if name starts with any string found in the slice
 // of prefixes.
 func HasPrefix(name string, prefixes []string) bool {
@@ -53,189 +38,255 @@ func RandomInt(max int) (int64, error) {
 	return random.Int64(), nil
 }
 
-// RandomLink returns a random mdlinks.Link from a slice.
-func RandomLink(links []mdlinks.Link) (*mdlinks.Link, error) {
-	randInt, err := RandomInt(len(links))
-	if err != nil {
-		return nil, err
-	}
-	randLink := links[randInt]
-
-	return &randLink, nil
-}
-
-// ScrubScrollNames is a helper function that replaces any Link containing the
-// name ":scroll:" with the name of the Link found directly after it. Because
-// PWL self hosted papers are indicated by a scroll icon prepended to the link,
-// the markdown parser assumes this is the name of the link. In most cases the
-// actual name is found immediately after the scroll icon.
-func ScrubScrollNames(links []mdlinks.Link) *[]mdlinks.Link {
-	temp := make([]mdlinks.Link, len(links))
-	for i, link := range links {
-		if link.Name == ":scroll:" {
-			link.Name = links[i+1].Name
+// Shuffle randomly reorders a slice of strings in place.
+func Shuffle(s []string) {
+	for i := len(s) - 1; i > 0; i-- {
+		j, err := RandomInt(i + 1)
+		if err != nil {
+			j = int64(mrand.Intn(i + 1))
 		}
-		temp[i] = link
+		s[i], s[j] = s[j], s[i]
 	}
-
-	return &temp
 }
 
-// RandomGithubReadme returns a README file from a randomly chosen directory
-// within a Github repository. It will recursively try to find a README file
-// until either one is found or the Github API rate limit has been hit.
-func RandomGithubReadme(owner, repo, dir string) (*Readme, error) {
-	log.Printf("INFO: scanning %s\n", dir)
-	if HasPrefix(dir, []string{".", "_", "CODE_OF_CONDUCT.md"}) {
-		log.Printf("INFO: skipping %s\n", dir)
-		return RandomGithubReadme(owner, repo, "/")
+// CheckPaper returns an error if paper can not be posted as is.
+func CheckPaper(paper *Paper) error {
+	if strings.TrimSpace(paper.Name) == "" {
+		return fmt.Errorf("%s has no name", paper.URL)
 	}
 
-	client := github.NewClient(nil)
-	fc, dc, resp, err := client.Repositories.GetContents(owner, repo, dir, nil)
-	log.Printf("GITHUB: %d of %d API requests remaining, reset at %s.", resp.Remaining, resp.Limit, resp.Reset)
-	if err != nil {
-		if resp.Remaining < 1 {
-			return nil, err
-		}
-		log.Printf("FAILED: %s", err)
-		return RandomGithubReadme(owner, repo, "/")
+	links := []string{paper.URL}
+	if paper.Mirror != "" {
+		links = append(links, paper.Mirror)
 	}
-
-	if fc == nil {
-		randInt, err := RandomInt(len(dc))
+	for _, link := range links {
+		linkURL, err := url.Parse(link)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if linkURL.Scheme != "http" && linkURL.Scheme != "https" {
+			return fmt.Errorf("%s is not a web link", link)
 		}
-		randDir := dc[randInt]
-		randDirName := randDir.Name
-
-		readmePath := strings.Join([]string{*randDirName, "README.md"}, "/")
-		return RandomGithubReadme(owner, repo, readmePath)
 	}
 
-	HTMLURL := fc.HTMLURL
-	path := strings.Replace(*HTMLURL, "README.md", "", -1)
+	return nil
+}
 
-	content, err := fc.GetContent()
-	if err != nil {
-		return nil, err
-	}
+// Postable returns the first of papers that passes CheckPaper and, if
+// checker is not nil, whose links are all alive. Dead links are replaced by
+// the snapshots the checker found. It returns nil if no paper passes.
+func Postable(papers []*Paper, checker *LinkChecker) *Paper {
+	for _, paper := range papers {
+		if err := CheckPaper(paper); err != nil {
+			log.Printf("INFO: %s", err)
+			continue
+		}
 
-	return &Readme{path, content}, nil
-}
+		if checker != nil {
+			link, err := checker.Check(paper.URL, paper.Kind)
+			if err != nil {
+				log.Printf("INFO: %s", err)
+				continue
+			}
+			paper.URL = link
+
+			if paper.Mirror != "" {
+				link, err := checker.Check(paper.Mirror, paper.Kind)
+				if err != nil {
+					log.Printf("INFO: %s", err)
+					continue
+				}
+				paper.Mirror = link
+			}
+		}
 
-// FindPaper is a recursive function that uses RandomGithubReadme to find a
-// suitable README.md file. Currently a suitable README.md file is one that
-// contains a link to a PDF.
-//
-// NOTE: Maybe modify IsPDF() to check for other formats such as postscript
-// files and rename function to IsPaper().
-func FindPaper(owner, repo, path string) (*mdlinks.Link, string, error) {
-	readme, err := RandomGithubReadme(owner, repo, path)
-	if err != nil {
-		return nil, "", err
+		return paper
 	}
 
-	linksUnscrubbed := mdlinks.Links([]byte(readme.Content))
-	links := ScrubScrollNames(linksUnscrubbed)
+	return nil
+}
 
-	link, err := RandomLink(*links)
+// FindPaper picks a random paper entry from the indexer's catalog,
+// rebuilding the catalog first if it is out of date. Entries are tried until
+// one can be posted, in the form prefer or failing that another, or the
+// attempt budget runs out. A README counts a miss when every one of its
+// entries is rejected, and a paper found resets its misses. If fetcher is
+// not nil, the metadata of a PDF paper is read and preferred over the
+// README link text.
+func FindPaper(indexer *Indexer, prefer LinkForm, checker *LinkChecker, fetcher *MetadataFetcher) (*Paper, error) {
+	catalog, err := indexer.Catalog()
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	if !IsPDF(link.Location) {
-		log.Printf("INFO: %s is not a paper", link.Location)
-		return FindPaper(owner, repo, path)
+	// left counts the entries of each README not tried yet.
+	left := make(map[string]int)
+	counted := make(map[string]bool)
+	for _, entry := range catalog.Entries {
+		if !counted[entry.Key()] {
+			counted[entry.Key()] = true
+			left[entry.ReadmePath]++
+		}
 	}
 
-	paperURL, err := url.Parse(link.Location)
-	if err != nil {
-		return nil, "", err
+	tried := make(map[string]bool)
+	skip := func(entry *PaperEntry) bool {
+		return tried[entry.Key()] || indexer.IsDeadEnd(entry.ReadmePath)
 	}
 
-	if !paperURL.IsAbs() {
-		absURL := strings.Join([]string{readme.Path, link.Location}, "")
-		link.Location = absURL
-	}
+	for attempt := 0; attempt < indexer.Budget.Attempts; attempt++ {
+		entry, err := catalog.RandomEntry(skip)
+		if err != nil {
+			return nil, err
+		}
+		tried[entry.Key()] = true
+		left[entry.ReadmePath]--
+
+		paper := Postable(entry.Papers(prefer), checker)
+		if paper == nil {
+			if left[entry.ReadmePath] == 0 {
+				indexer.Miss(entry.ReadmePath)
+			}
+			continue
+		}
+		indexer.Hit(entry.ReadmePath)
 
-	// Replace hyphens and underscores with spaces
-	re := regexp.MustCompile(`(-|_)`)
-	topic := re.ReplaceAllString(filepath.Base(readme.Path), " ")
+		if fetcher != nil && paper.Kind == KindPDF {
+			link := paper.URL
+			if paper.Mirror != "" {
+				link = paper.Mirror
+			}
+			meta, err := fetcher.Fetch(link)
+			if err != nil {
+				log.Printf("INFO: reading metadata: %s", err)
+			} else {
+				ApplyMetadata(paper, meta)
+			}
+		}
 
-	// Capitalize topic words then strip spaces
-	topic = strings.Replace(strings.Title(topic), " ", "", -1)
-	link.Name = strings.Replace(link.Name, "\n", " ", -1)
+		return paper, nil
+	}
 
-	return link, topic, nil
+	return nil, &SearchError{Reason: BudgetExhausted}
 }
 
-// TwitterLoadCredentials loads Twitter API tokens from environment variables.
-func TwitterLoadCredentials() (client *twittergo.Client, err error) {
-	config := &oauth1a.ClientConfig{
-		ConsumerKey:    os.Getenv("CONSUMER_KEY"),
-		ConsumerSecret: os.Getenv("CONSUMER_SECRET"),
+// Publish publishes post with every publisher, giving each timeout to do
+// so, and records every successful post in history. The paper is added to
+// feeds once if any publisher succeeded.
+func Publish(publishers []Publisher, post Post, timeout time.Duration, history *History, feeds *FeedStore) {
+	succeeded := false
+	for _, publisher := range publishers {
+		prefix := strings.ToUpper(publisher.Name())
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		published, err := publisher.Publish(ctx, post)
+		cancel()
+		if err != nil {
+			log.Printf("%s: %s\n", prefix, err)
+			continue
+		}
+		succeeded = true
+
+		log.Printf("%s: post successful: %s %s", prefix, published.ID, published.URL)
+		entry := NewHistoryEntry(post.Paper, published.ID)
+		entry.Publisher = publisher.Name()
+		entry.PostURL = published.URL
+		if err := history.Record(entry); err != nil {
+			log.Printf("ERROR: recording history: %s\n", err)
+		}
 	}
-	user := oauth1a.NewAuthorizedConfig(os.Getenv("API_KEY"), os.Getenv("API_SECRET"))
-	client = twittergo.NewClient(config, user)
 
-	return
+	if succeeded {
+		if err := feeds.Add(NewFeedItem(post.Paper, time.Now())); err != nil {
+			log.Printf("FEED: %s\n", err)
+		}
+	}
 }
 
-// TwitterUpdateStatus tweets a new status.
-func TwitterUpdateStatus(status string) (*twittergo.Tweet, error) {
-	client, err := TwitterLoadCredentials()
+func main() {
+	config, err := LoadConfig()
 	if err != nil {
-		return nil, err
+		log.Fatalf("ERROR: %s\n", err)
 	}
 
-	data := url.Values{}
-	data.Set("status", status)
-	body := strings.NewReader(data.Encode())
+	if len(os.Args) > 1 && os.Args[1] == "twitter-auth" {
+		if config.TwitterClientID == "" {
+			log.Fatalf("ERROR: twitter-auth needs TWITTER_CLIENT_ID\n")
+		}
+		auth, err := NewTwitterAuth(config)
+		if err != nil {
+			log.Fatalf("ERROR: %s\n", err)
+		}
+		if err := TwitterAuthorize(context.Background(), auth.(*TwitterOAuth2), os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("ERROR: %s\n", err)
+		}
+		return
+	}
 
-	req, err := http.NewRequest("POST", "/1.1/statuses/update.json", body)
-	if err != nil {
-		return nil, err
+	feeds := NewFeedStore(config.FeedFile, config.FeedMaxItems)
+	feedInfo := FeedInfo{Title: config.FeedTitle, Description: config.FeedDescription, URL: config.FeedURL}
+	if len(os.Args) > 1 && os.Args[1] == "write-feeds" {
+		dir := "."
+		if len(os.Args) > 2 {
+			dir = os.Args[2]
+		}
+		if err := WriteFeeds(feeds, feedInfo, dir); err != nil {
+			log.Fatalf("ERROR: %s\n", err)
+		}
+		return
+	}
+	if config.FeedAddr != "" {
+		go func() {
+			log.Printf("FEED: serving feeds on %s\n", config.FeedAddr)
+			log.Printf("FEED: %s\n", http.ListenAndServe(config.FeedAddr, FeedHandler(feeds, feedInfo)))
+		}()
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := client.SendRequest(req)
+	cache := NewCacheTransport(config.CacheDir, config.CacheMaxSize, config.CacheTTL)
+	client, err := NewGithubClient(config, cache)
 	if err != nil {
-		return nil, err
+		log.Fatalf("ERROR: %s\n", err)
 	}
-
-	tweet := &twittergo.Tweet{}
-	err = resp.Parse(tweet)
+	source, err := NewPaperSource(config, client)
 	if err != nil {
-		return nil, err
+		log.Fatalf("ERROR: %s\n", err)
+	}
+	indexer := NewIndexer(source, config.Owner, config.Repo, config.IndexRef, config.IndexRefresh, config.Budget)
+	indexer.Classifier = NewClassifier(config.PaperRules)
+	indexer.Resolver = NewResolver(config.BlobStyle)
+	indexer.SkipSections = config.SkipSections
+	indexer.MaxDepth = config.TopicMaxDepth
+	indexer.Markers = mdlinks.DefaultMarkers.With(config.Markers...)
+
+	var checker *LinkChecker
+	if config.LinkCheck {
+		checker = NewLinkChecker(config.LinkCheckTimeout, config.WaybackURL)
 	}
 
-	return tweet, nil
-}
+	var fetcher *MetadataFetcher
+	if config.PDFMetadata {
+		fetcher = NewMetadataFetcher(config.PDFTimeout, config.PDFMaxSize)
+	}
+
+	history := NewHistory(config.HistoryFile)
+
+	publishers, err := NewPublishers(config)
+	if err != nil {
+		log.Fatalf("ERROR: %s\n", err)
+	}
 
-func main() {
 	for {
-		paper, topic, err := FindPaper("papers-we-love", "papers-we-love", "/")
+		paper, err := FindPaper(indexer, config.LinkForm, checker, fetcher)
+		cache.LogStats()
 		if err != nil {
 			log.Printf("ERROR: %s\n", err)
 		} else {
-			log.Printf("INFO: found paper: %s\n", paper.Location)
+			log.Printf("INFO: found paper: %s linked from %s\n", paper.URL, paper.Permalink)
+			log.Printf("INFO: paper %q, %s\n", paper.Name, paper.Sources)
 
-			status := strings.Join([]string{paper.Name, paper.Location, "#" + topic}, "\n")
-			tweet, err := TwitterUpdateStatus(status)
-			if err != nil {
-				log.Printf("TWITTER: %s\n", err)
-			} else {
-				log.Printf("TWITTER: tweet successful: %s", tweet.IdStr())
-			}
+			Publish(publishers, NewPost(paper), config.PublishTimeout, history, feeds)
 		}
 
-		mrand.Seed(time.Now().Unix())
-		// Random integer between 24 and 48. Int(n) returns a random Int from 0
-		// to n exclusive.
-		sleepTime := mrand.Intn(25) + 24
-		log.Printf("INFO: sleeping for %d hours ...", sleepTime)
-		time.Sleep(time.Duration(sleepTime) * time.Hour)
+		time.Sleep(SleepTime(err))
 	}
 }
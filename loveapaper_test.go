@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakePublisher publishes every post as id, or fails with err if set.
+type fakePublisher struct {
+	name string
+	id   string
+	err  error
+}
+
+func (p *fakePublisher) Name() string {
+	return p.name
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, post Post) (*Published, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return &Published{ID: p.id, URL: "https://example.org/" + p.id}, nil
+}
+
+func TestPublish(t *testing.T) {
+	paper := &Paper{Name: "Paxos Made Simple", URL: "https://example.org/paxos.pdf", Kind: KindPDF, Topic: "distributed_systems"}
+	failing := &fakePublisher{name: "mastodon", err: errors.New("unavailable")}
+	tests := []struct {
+		name       string
+		publishers []Publisher
+		history    []string
+		feed       int
+	}{
+		{"all succeed", []Publisher{&fakePublisher{name: "twitter", id: "1"}, &fakePublisher{name: "bluesky", id: "2"}}, []string{"twitter", "bluesky"}, 1},
+		{"one succeeds", []Publisher{failing, &fakePublisher{name: "slack", id: "3"}}, []string{"slack"}, 1},
+		{"all fail", []Publisher{failing}, nil, 0},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		history := NewHistory(filepath.Join(dir, "history.jsonl"))
+		feeds := NewFeedStore(filepath.Join(dir, "feed.jsonl"), 10)
+
+		Publish(test.publishers, NewPost(paper), time.Second, history, feeds)
+
+		entries, err := history.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Publisher)
+		}
+		if !reflect.DeepEqual(got, test.history) {
+			t.Errorf("%s: history of %q, want %q", test.name, got, test.history)
+		}
+
+		items, err := feeds.Items()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != test.feed {
+			t.Errorf("%s: %d feed items, want %d", test.name, len(items), test.feed)
+		}
+		if len(items) > 0 && (items[0].Title != paper.Name || items[0].Link != paper.URL) {
+			t.Errorf("%s: feed item %+v, want the paper", test.name, items[0])
+		}
+	}
+}
+
+func TestPublishSamePaperTwice(t *testing.T) {
+	paper := &Paper{Name: "Paxos Made Simple", URL: "https://example.org/paxos.pdf", Kind: KindPDF, Topic: "distributed_systems"}
+	dir := t.TempDir()
+	history := NewHistory(filepath.Join(dir, "history.jsonl"))
+	feeds := NewFeedStore(filepath.Join(dir, "feed.jsonl"), 10)
+	publishers := []Publisher{&fakePublisher{name: "twitter", id: "1"}}
+
+	Publish(publishers, NewPost(paper), time.Second, history, feeds)
+	Publish(publishers, NewPost(paper), time.Second, history, feeds)
+
+	items, err := feeds.Items()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].GUID == items[1].GUID {
+		t.Errorf("feed items %+v, want two with their own GUIDs", items)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// MastodonPublisher posts statuses to a Mastodon instance.
+type MastodonPublisher struct {
+	// InstanceURL is the base URL of the instance, e.g.
+	// https://mastodon.social.
+	InstanceURL string
+	Token       string
+
+	// Visibility is public, unlisted, private or direct. Language is an
+	// ISO 639 language code. Either may be empty to use the account's
+	// defaults.
+	Visibility string
+	Language   string
+
+	client *http.Client
+}
+
+// NewMastodonPublisher returns a MastodonPublisher posting to the instance
+// at instanceURL with the access token.
+func NewMastodonPublisher(instanceURL, token, visibility, language string) *MastodonPublisher {
+	return &MastodonPublisher{
+		InstanceURL: strings.TrimRight(instanceURL, "/"),
+		Token:       token,
+		Visibility:  visibility,
+		Language:    language,
+		client:      &http.Client{},
+	}
+}
+
+func (m *MastodonPublisher) Name() string {
+	return "mastodon"
+}
+
+// mastodonStatus is the request body of POST /api/v1/statuses.
+type mastodonStatus struct {
+	Status     string `json:"status"`
+	Visibility string `json:"visibility,omitempty"`
+	Language   string `json:"language,omitempty"`
+}
+
+// Publish posts the status. The post's idempotency key is sent so a retried
+// request does not post twice.
+func (m *MastodonPublisher) Publish(ctx context.Context, post Post) (*Published, error) {
+	body, err := json.Marshal(&mastodonStatus{
+		Status:     post.Text,
+		Visibility: m.Visibility,
+		Language:   m.Language,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", m.InstanceURL+"/api/v1/statuses", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+m.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+	if post.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", post.IdempotencyKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("posting status: %s: %s", resp.Status, apiErr.Error)
+		}
+		return nil, fmt.Errorf("posting status: %s", resp.Status)
+	}
+
+	var status struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+
+	return &Published{ID: status.ID, URL: status.URL}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMastodonPublish(t *testing.T) {
+	var keys []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/statuses" {
+			t.Errorf("got %s %s, want POST /api/v1/statuses", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer secret")
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", got)
+		}
+		var status mastodonStatus
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			t.Error(err)
+		}
+		if status.Visibility != "unlisted" || status.Language != "en" || !strings.HasPrefix(status.Status, "Paxos Made Simple (PDF)\n") {
+			t.Errorf("got status %+v", status)
+		}
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		fmt.Fprintf(w, `{"id": "%d", "url": "https://mastodon.example/@pwl/%d"}`, len(keys), len(keys))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	paper := &Paper{
+		Name:      "Paxos Made Simple",
+		URL:       "https://lamport.azurewebsites.net/pubs/paxos-simple.pdf",
+		Kind:      KindPDF,
+		Topic:     "distributed_systems",
+		Permalink: "https://github.com/papers-we-love/papers-we-love/blob/master/distributed_systems/README.md#L10",
+	}
+	m := NewMastodonPublisher(server.URL+"/", "secret", "unlisted", "en")
+	for i := 1; i <= 2; i++ {
+		published, err := m.Publish(context.Background(), NewPost(paper))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprint(i); published.ID != want || published.URL != "https://mastodon.example/@pwl/"+want {
+			t.Errorf("Publish() = %+v, want ID %s", published, want)
+		}
+	}
+
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Idempotency-Key headers = %q, want the same key twice", keys)
+	}
+	if want := NewPost(paper).IdempotencyKey; keys[0] != want {
+		t.Errorf("Idempotency-Key = %q, want the post's key %q", keys[0], want)
+	}
+}
+
+func TestMastodonPublishError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"error": "Validation failed: Text character limit of 500 exceeded"}`)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	m := NewMastodonPublisher(server.URL, "secret", "", "")
+	_, err := m.Publish(context.Background(), Post{Text: "text"})
+	if err == nil || !strings.Contains(err.Error(), "character limit") {
+		t.Errorf("Publish() error = %v, want the API's error message", err)
+	}
+}
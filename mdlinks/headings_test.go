@@ -0,0 +1,68 @@
+package mdlinks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLinkHeadings checks the headings enclosing the links in each
+// testdata/headings/*.md file against its .golden file, which lists one link
+// per line as its location and its headings, each prefixed by its level and
+// separated by " > ". Run with -update to rewrite the golden files.
+func TestLinkHeadings(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "headings", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no test inputs")
+	}
+
+	for _, input := range inputs {
+		markdown, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got strings.Builder
+		for _, link := range Links(markdown) {
+			var path []string
+			for _, heading := range link.Headings {
+				path = append(path, fmt.Sprintf("h%d %s", heading.Level, heading.Text))
+			}
+			fmt.Fprintf(&got, "%s\t%s\n", link.Location, strings.Join(path, " > "))
+		}
+
+		golden := strings.TrimSuffix(input, ".md") + ".golden"
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(got.String()), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != string(want) {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", input, got.String(), want)
+		}
+	}
+}
+
+func TestLinkSection(t *testing.T) {
+	links := Links([]byte("[a](a.pdf)\n\n# Papers\n\n## Systems\n\n[b](b.pdf)\n"))
+	if len(links) != 2 {
+		t.Fatalf("got %d links, want 2", len(links))
+	}
+	if got := links[0].Section(); got != "" {
+		t.Errorf("Section() before any heading = %q, want none", got)
+	}
+	if got := links[1].Section(); got != "Systems" {
+		t.Errorf("Section() = %q, want Systems", got)
+	}
+}
@@ -0,0 +1,196 @@
+package mdlinks
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Item is a list item or, outside of lists, a paragraph, with the links
+// found in its own text. Nested list items are its Children.
+type Item struct {
+	// List is set for list items and Depth is their nesting, 0 for items
+	// of a top level list.
+	List  bool
+	Depth int
+
+	// Line is the 1-based line of the item's first link, or zero if it has
+	// none.
+	Line int
+
+	// Text is the plain text of the item with every link replaced by its
+	// name. Prose is the plain text without the links. Neither includes
+	// markers or the text of children.
+	Text  string
+	Prose string
+
+	Links    []Link
+	Children []Item
+
+	// Headings are the headings of the sections enclosing the item, from
+	// the outermost to the innermost.
+	Headings []Heading
+}
+
+// pendingItem is an item collected while a document is rendered. Its links
+// are indexes into the renderer's links, which are only located once the
+// whole document has been rendered.
+type pendingItem struct {
+	item     Item
+	text     string
+	prose    string
+	links    []int
+	children []*pendingItem
+}
+
+// pendingList is a list being rendered. current is its item being rendered,
+// which collects the links and nested items found until the item ends.
+type pendingList struct {
+	items   []*pendingItem
+	current *pendingItem
+}
+
+func (p *pendingList) item() *pendingItem {
+	if p.current == nil {
+		p.current = &pendingItem{}
+	}
+
+	return p.current
+}
+
+// Items returns the list items and paragraphs of markdown, in document
+// order, with the links found by the extractor. Links outside of list items
+// and paragraphs, such as those in headings and tables, get an item of
+// their own.
+func (e *Extractor) Items(markdown []byte) []Item {
+	l := e.render(markdown, false)
+	links := l.Links()
+	locate(markdown, links)
+	if e.Markers != nil {
+		e.Markers.Annotate(markdown, links)
+	}
+
+	// The prose of an item is its text rendered without links. Both
+	// renderings parse the same blocks, so their items line up.
+	prose(l.items, e.render(markdown, true).items)
+
+	items := make([]Item, 0, len(l.items))
+	for _, p := range l.items {
+		items = append(items, e.finish(p, links))
+	}
+
+	return items
+}
+
+// prose sets the prose of items from the text of the same items rendered
+// without links.
+func prose(items, withoutLinks []*pendingItem) {
+	for i, p := range items {
+		if i >= len(withoutLinks) {
+			return
+		}
+		p.prose = withoutLinks[i].text
+		prose(p.children, withoutLinks[i].children)
+	}
+}
+
+// finish returns the item collected as p, with its links taken from links.
+func (e *Extractor) finish(p *pendingItem, links []Link) Item {
+	item := p.item
+	item.Text = e.strip(p.text)
+	item.Prose = e.strip(p.prose)
+
+	own := make([]Link, 0, len(p.links))
+	for _, i := range p.links {
+		own = append(own, links[i])
+	}
+	item.Links = FilterKinds(own, e.Kinds...)
+	if len(item.Links) > 0 {
+		item.Line = item.Links[0].Line
+	}
+
+	for _, child := range p.children {
+		item.Children = append(item.Children, e.finish(child, links))
+	}
+
+	return item
+}
+
+// strip removes the markers from text.
+func (e *Extractor) strip(text string) string {
+	if e.Markers == nil {
+		return PlainText([]byte(text))
+	}
+	text = normalize(text)
+	for _, m := range e.Markers.Markers() {
+		if m.Text != "" {
+			text = strings.Replace(text, m.Text, " ", -1)
+		}
+	}
+
+	return PlainText([]byte(text))
+}
+
+// List collects the items of the list. Their text is left out of the
+// output, so the text of an item never includes that of its children.
+func (l *LinkRenderer) List(out *bytes.Buffer, text func() bool, flags int) {
+	marker := out.Len()
+	l.lists = append(l.lists, &pendingList{})
+	text()
+	list := l.lists[len(l.lists)-1]
+	l.lists = l.lists[:len(l.lists)-1]
+	out.Truncate(marker)
+
+	if len(l.lists) > 0 {
+		parent := l.lists[len(l.lists)-1].item()
+		parent.children = append(parent.children, list.items...)
+		return
+	}
+	l.items = append(l.items, list.items...)
+}
+
+// ListItem ends the current item of the innermost list.
+func (l *LinkRenderer) ListItem(out *bytes.Buffer, text []byte, flags int) {
+	if len(l.lists) == 0 {
+		return
+	}
+	list := l.lists[len(l.lists)-1]
+	p := list.item()
+	p.item.List = true
+	p.item.Depth = len(l.lists) - 1
+	p.item.Headings = append([]Heading(nil), l.headings...)
+	p.text = string(text)
+	list.items = append(list.items, p)
+	list.current = nil
+}
+
+// Paragraph collects a paragraph outside of any list as an item of its
+// own. The paragraphs of list items are part of the item's text.
+func (l *LinkRenderer) Paragraph(out *bytes.Buffer, text func() bool) {
+	marker := out.Len()
+	if len(l.lists) > 0 || l.paragraph != nil {
+		if !text() {
+			out.Truncate(marker)
+			return
+		}
+		out.WriteByte('\n')
+		return
+	}
+
+	l.paragraph = &pendingItem{item: Item{Headings: append([]Heading(nil), l.headings...)}}
+	ok := text()
+	p := l.paragraph
+	l.paragraph = nil
+	if !ok {
+		out.Truncate(marker)
+		return
+	}
+	p.text = string(out.Bytes()[marker:])
+	out.WriteByte('\n')
+	l.items = append(l.items, p)
+}
+
+// Items returns the list items and paragraphs of markdown with links of
+// every kind. It is a shorthand for NewExtractor().Items(markdown).
+func Items(markdown []byte) []Item {
+	return defaultExtractor.Items(markdown)
+}
@@ -0,0 +1,91 @@
+package mdlinks
+
+import (
+	"reflect"
+	"testing"
+)
+
+// itemSummary is the part of an Item the tests compare.
+type itemSummary struct {
+	List     bool
+	Depth    int
+	Line     int
+	Text     string
+	Prose    string
+	Links    int
+	Children []itemSummary
+}
+
+func summarize(items []Item) []itemSummary {
+	var summaries []itemSummary
+	for _, item := range items {
+		summaries = append(summaries, itemSummary{
+			List:     item.List,
+			Depth:    item.Depth,
+			Line:     item.Line,
+			Text:     item.Text,
+			Prose:    item.Prose,
+			Links:    len(item.Links),
+			Children: summarize(item.Children),
+		})
+	}
+
+	return summaries
+}
+
+func TestItems(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     []itemSummary
+	}{
+		{
+			"nested",
+			"* [Paxos](paxos.pdf) :scroll: by Lamport, 2001\n  * [Talk](https://youtube.com/x)\n  * Notes\n* [Raft](raft.pdf)\n",
+			[]itemSummary{
+				{List: true, Line: 1, Text: "Paxos by Lamport, 2001", Prose: "by Lamport, 2001", Links: 1, Children: []itemSummary{
+					{List: true, Depth: 1, Line: 2, Text: "Talk", Links: 1},
+					{List: true, Depth: 1, Text: "Notes", Prose: "Notes"},
+				}},
+				{List: true, Line: 4, Text: "Raft", Links: 1},
+			},
+		},
+		{
+			"blockquote",
+			"> * [Paxos](paxos.pdf) - Lamport\n> * [Raft](raft.pdf)\n",
+			[]itemSummary{
+				{List: true, Line: 1, Text: "Paxos - Lamport", Prose: "- Lamport", Links: 1},
+				{List: true, Line: 2, Text: "Raft", Links: 1},
+			},
+		},
+		{
+			"setext heading",
+			"Consensus\n=========\n\nSee [Raft](raft.pdf).\n",
+			[]itemSummary{
+				{Line: 4, Text: "See Raft.", Prose: "See .", Links: 1},
+			},
+		},
+		{
+			"escaped location",
+			"* [x](a\\_b.pdf) by A and B, 2014\n",
+			[]itemSummary{
+				{List: true, Line: 1, Text: "x by A and B, 2014", Prose: "by A and B, 2014", Links: 1},
+			},
+		},
+		{
+			"heading link",
+			"# [Papers](papers.pdf)\n\n* [Raft](raft.pdf)\n",
+			[]itemSummary{
+				{Line: 1, Text: "Papers", Links: 1},
+				{List: true, Line: 3, Text: "Raft", Links: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := summarize(Items([]byte(test.markdown)))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", test.name, got, test.want)
+		}
+	}
+}
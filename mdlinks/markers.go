@@ -0,0 +1,207 @@
+package mdlinks
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Annotation is a property of a link signalled by a marker written next to
+// it, such as an emoji.
+type Annotation string
+
+const (
+	// SelfHosted marks a link to a copy of the paper kept in the
+	// repository itself.
+	SelfHosted Annotation = "self-hosted"
+
+	// HasVideo marks a link to a recorded talk about the paper.
+	HasVideo Annotation = "video"
+)
+
+// Marker is an emoji shortcode such as ":scroll:", or a unicode emoji, that
+// annotates the link it is written in or in front of.
+type Marker struct {
+	Text       string
+	Annotation Annotation
+}
+
+// DefaultMarkers recognises the markers used by Papers We Love.
+var DefaultMarkers = NewMarkerRegistry(
+	Marker{":scroll:", SelfHosted},
+	Marker{"\U0001F4DC", SelfHosted},
+	Marker{":movie_camera:", HasVideo},
+	Marker{"\U0001F3A5", HasVideo},
+	Marker{":video_camera:", HasVideo},
+	Marker{"\U0001F4F9", HasVideo},
+)
+
+// MarkerRegistry annotates links with the markers written next to them. It
+// is safe for concurrent use.
+type MarkerRegistry struct {
+	mu      sync.RWMutex
+	markers []Marker
+}
+
+// NewMarkerRegistry returns a MarkerRegistry recognising markers.
+func NewMarkerRegistry(markers ...Marker) *MarkerRegistry {
+	r := &MarkerRegistry{}
+	for _, m := range markers {
+		r.Register(m)
+	}
+
+	return r
+}
+
+// Register adds a marker to the registry, replacing any marker with the
+// same text.
+func (r *MarkerRegistry) Register(m Marker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m.Text = normalize(m.Text)
+	for i := range r.markers {
+		if r.markers[i].Text == m.Text {
+			r.markers[i] = m
+			return
+		}
+	}
+	r.markers = append(r.markers, m)
+
+	// Longer markers are tried first so a marker that starts with another
+	// is not mistaken for it.
+	sort.SliceStable(r.markers, func(i, j int) bool {
+		return len(r.markers[i].Text) > len(r.markers[j].Text)
+	})
+}
+
+// Markers returns the registered markers.
+func (r *MarkerRegistry) Markers() []Marker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]Marker(nil), r.markers...)
+}
+
+// With returns a new registry recognising the markers of r and markers,
+// which replace those of r with the same text. r is left unchanged.
+func (r *MarkerRegistry) With(markers ...Marker) *MarkerRegistry {
+	return NewMarkerRegistry(append(r.Markers(), markers...)...)
+}
+
+// Annotate annotates every link with the markers at the start or end of its
+// name, removing them from the name, and with the markers written in
+// source directly in front of it on the same line. Markers ending a line
+// annotate the last link on it. A link whose name is nothing but markers is
+// left with an empty name.
+func (r *MarkerRegistry) Annotate(source []byte, links []Link) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range links {
+		link := &links[i]
+
+		link.Name = r.strip(link, link.Name, true)
+
+		if link.Line == 0 || link.Offset > len(source) {
+			continue
+		}
+		before := source[:link.Offset]
+		lineStart := bytes.LastIndexByte(before, '\n') + 1
+		r.strip(link, string(before[lineStart:]), false)
+
+		if i+1 < len(links) && links[i+1].Line == link.Line {
+			continue
+		}
+		after := source[link.Offset:]
+		if lineEnd := bytes.IndexByte(after, '\n'); lineEnd >= 0 {
+			after = after[:lineEnd]
+		}
+		r.strip(link, string(after), false)
+	}
+}
+
+// strip adds the annotations of the markers at the end of text, and at its
+// start too if leading is set, to link and returns text without them.
+func (r *MarkerRegistry) strip(link *Link, text string, leading bool) string {
+	text = strings.TrimSpace(normalize(text))
+	for {
+		m, ok := r.match(text, strings.HasSuffix)
+		if ok {
+			text = strings.TrimSpace(strings.TrimSuffix(text, m.Text))
+			link.annotate(m.Annotation)
+			continue
+		}
+		if !leading {
+			break
+		}
+		m, ok = r.match(text, strings.HasPrefix)
+		if ok {
+			text = strings.TrimSpace(strings.TrimPrefix(text, m.Text))
+			link.annotate(m.Annotation)
+			continue
+		}
+		break
+	}
+
+	return text
+}
+
+// match returns the first marker for which has(text, marker) is true.
+func (r *MarkerRegistry) match(text string, has func(string, string) bool) (Marker, bool) {
+	for _, m := range r.markers {
+		if m.Text != "" && has(text, m.Text) {
+			return m, true
+		}
+	}
+
+	return Marker{}, false
+}
+
+// normalize removes emoji variation selectors so "📜" and "📜️" are the
+// same marker.
+func normalize(s string) string {
+	return strings.Replace(s, "\ufe0f", "", -1)
+}
+
+// annotate adds a to the link's annotations unless it already has it.
+func (l *Link) annotate(a Annotation) {
+	if !l.Has(a) {
+		l.Annotations = append(l.Annotations, a)
+	}
+}
+
+// Has returns true if the link is annotated with a.
+func (l *Link) Has(a Annotation) bool {
+	for _, annotation := range l.Annotations {
+		if annotation == a {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseMarkers parses a comma separated list of marker=annotation pairs,
+// such as ":memo:=self-hosted,:tv:=video".
+func ParseMarkers(spec string) ([]Marker, error) {
+	var markers []Marker
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("marker %q is not of the form marker=annotation", pair)
+		}
+		markers = append(markers, Marker{
+			Text:       strings.TrimSpace(pair[:i]),
+			Annotation: Annotation(strings.TrimSpace(pair[i+1:])),
+		})
+	}
+
+	return markers, nil
+}
@@ -0,0 +1,149 @@
+package mdlinks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotate(t *testing.T) {
+	type annotated struct {
+		Name        string
+		Annotations []Annotation
+	}
+	tests := []struct {
+		markdown string
+		want     []annotated
+	}{
+		{
+			"* [Paxos](paxos.pdf) :scroll:\n",
+			[]annotated{{"Paxos", []Annotation{SelfHosted}}},
+		},
+		{
+			"* :scroll: [Paxos](paxos.pdf)\n",
+			[]annotated{{"Paxos", []Annotation{SelfHosted}}},
+		},
+		{
+			"* [\U0001F4DC\ufe0f Paxos :movie_camera:](paxos.pdf)\n",
+			[]annotated{{"Paxos", []Annotation{HasVideo, SelfHosted}}},
+		},
+		{
+			"* [:scroll:](paxos.pdf)\n",
+			[]annotated{{"", []Annotation{SelfHosted}}},
+		},
+		{
+			"* [Paxos](paxos.pdf) :scroll: [Talk](talk.html) :movie_camera:\n",
+			[]annotated{{"Paxos", nil}, {"Talk", []Annotation{SelfHosted, HasVideo}}},
+		},
+		{
+			"* [Paxos](paxos.pdf) by Lamport :scroll:\n",
+			[]annotated{{"Paxos", []Annotation{SelfHosted}}},
+		},
+		{
+			"* Notes :scroll:\n* [Raft](raft.pdf)\n",
+			[]annotated{{"Raft", nil}},
+		},
+		{
+			"* :movie_camera:\n\n[Raft](raft.pdf)\n",
+			[]annotated{{"Raft", nil}},
+		},
+		{
+			"* Paxos :scroll:\n  * [Raft](raft.pdf)\n",
+			[]annotated{{"Raft", nil}},
+		},
+		{
+			"* [Paxos](paxos.pdf) :memo:\n",
+			[]annotated{{"Paxos", nil}},
+		},
+	}
+
+	for _, test := range tests {
+		var got []annotated
+		for _, link := range Links([]byte(test.markdown)) {
+			got = append(got, annotated{link.Name, link.Annotations})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q:\ngot  %+v\nwant %+v", test.markdown, got, test.want)
+		}
+	}
+}
+
+func TestItemsIgnoreOrphanedMarkers(t *testing.T) {
+	items := Items([]byte("* Notes :scroll:\n* [Raft](raft.pdf) by Ongaro\n"))
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	if items[0].Text != "Notes" || len(items[0].Links) != 0 {
+		t.Errorf("first item = %q with %d links, want Notes without links", items[0].Text, len(items[0].Links))
+	}
+	if got := items[1].Links; len(got) != 1 || len(got[0].Annotations) != 0 {
+		t.Errorf("second item links = %+v, want Raft without annotations", got)
+	}
+}
+
+func TestRegisterDeduplicates(t *testing.T) {
+	r := NewMarkerRegistry(
+		Marker{":scroll:", SelfHosted},
+		Marker{":scroll:", SelfHosted},
+		Marker{"\U0001F4DC", SelfHosted},
+		Marker{"\U0001F4DC\ufe0f", SelfHosted},
+	)
+	want := []Marker{{":scroll:", SelfHosted}, {"\U0001F4DC", SelfHosted}}
+	if got := r.Markers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Markers() = %q, want %q", got, want)
+	}
+
+	r.Register(Marker{":scroll:", HasVideo})
+	want = []Marker{{":scroll:", HasVideo}, {"\U0001F4DC", SelfHosted}}
+	if got := r.Markers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Markers() after replacing :scroll: = %q, want %q", got, want)
+	}
+}
+
+func TestWithKeepsDefaultMarkers(t *testing.T) {
+	defaults := DefaultMarkers.Markers()
+
+	r := DefaultMarkers.With(Marker{":memo:", SelfHosted}, Marker{":scroll:", HasVideo})
+	r.Register(Marker{":tv:", HasVideo})
+
+	if got := DefaultMarkers.Markers(); !reflect.DeepEqual(got, defaults) {
+		t.Errorf("DefaultMarkers changed to %q, want %q", got, defaults)
+	}
+	if got := len(r.Markers()); got != len(defaults)+2 {
+		t.Errorf("With() registry has %d markers, want %d", got, len(defaults)+2)
+	}
+
+	markdown := []byte("* [Paxos](paxos.pdf) :memo:\n* [Raft](raft.pdf) :scroll:\n")
+	links := Links(markdown)
+	if links[0].Has(SelfHosted) || !links[1].Has(SelfHosted) {
+		t.Errorf("DefaultMarkers annotated %+v, want only :scroll: as self-hosted", links)
+	}
+
+	extractor := NewExtractor()
+	extractor.Markers = r
+	links = extractor.Links(markdown)
+	if !links[0].Has(SelfHosted) || !links[1].Has(HasVideo) || links[1].Has(SelfHosted) {
+		t.Errorf("With() registry annotated %+v, want :memo: self-hosted and :scroll: video", links)
+	}
+}
+
+func TestParseMarkers(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []Marker
+		ok   bool
+	}{
+		{"", nil, true},
+		{":memo:=self-hosted, :tv: = video", []Marker{{":memo:", SelfHosted}, {":tv:", HasVideo}}, true},
+		{"==video", []Marker{{"=", HasVideo}}, true},
+		{":memo:", nil, false},
+		{"=video", nil, false},
+		{":memo:=", nil, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseMarkers(test.spec)
+		if (err == nil) != test.ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseMarkers(%q) = %q, %v, want %q, ok %t", test.spec, got, err, test.want, test.ok)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package mdlinks
 
 import (
 	"bytes"
+	"html"
+	"regexp"
+	"strings"
 
 	"github.com/russross/blackfriday"
 )
@@ -9,78 +12,442 @@ import (
 type Link struct {
 	Name     string
 	Location string
+	Title    string
+	Kind     Kind
+
+	// Offset is the byte offset of the start of the link in the source
+	// markdown. Line and Column are its 1-based line and column, the
+	// column counted in characters. All three are zero if the link could
+	// not be found in the source.
+	Offset int
+	Line   int
+	Column int
+
+	// Headings are the headings of the sections enclosing the link, from
+	// the outermost to the innermost.
+	Headings []Heading
+
+	// Annotations are signalled by the markers written next to the link.
+	Annotations []Annotation
+
+	// ref is the id of the reference definition the link was resolved
+	// through, as written in the source, or empty for other links.
+	ref string
+}
+
+// Kind is the markdown syntax a link was written in.
+type Kind string
+
+const (
+	// Inline is a [name](location) link.
+	Inline Kind = "inline"
+
+	// Reference is a [name][id] link to a reference definition.
+	Reference Kind = "reference"
+
+	// AutoLink is a <location> link or, with EXTENSION_AUTOLINK, a bare URL.
+	AutoLink Kind = "autolink"
+
+	// HTML is an <a href="location"> anchor.
+	HTML Kind = "html"
+
+	// Image is an ![alt](location) or ![alt][id] image. Its Name is the
+	// alt text.
+	Image Kind = "image"
+)
+
+// AllKinds lists every link kind.
+var AllKinds = []Kind{Inline, Reference, AutoLink, HTML, Image}
+
+// Heading is a markdown heading. Level is 1 for "#" through 6 for "######".
+type Heading struct {
+	Text  string
+	Level int
 }
 
-var links []Link
+// Section returns the text of the innermost heading enclosing the link, or
+// an empty string if the link is not below a heading.
+func (l *Link) Section() string {
+	if len(l.Headings) == 0 {
+		return ""
+	}
+
+	return l.Headings[len(l.Headings)-1].Text
+}
+
+// LinkRenderer is a blackfriday.Renderer that collects links instead of
+// rendering output. A LinkRenderer must only be used for a single document
+// at a time.
+type LinkRenderer struct {
+	links    []Link
+	headings []Heading
+
+	// refs maps the lower cased ids of the document's reference
+	// definitions to their locations. pending holds the ids links have
+	// been resolved through, innermost last, until the links are rendered.
+	refs    map[string]string
+	pending []string
+
+	// anchor is the <a> tag being rendered, if any, and anchorStart the
+	// position in the output its content starts at.
+	anchor      *Link
+	anchorStart int
+
+	// omitLinks leaves links out of the output, so items are rendered as
+	// their prose.
+	omitLinks bool
 
-type LinkRenderer struct{}
+	// items are the list items and paragraphs rendered so far, lists the
+	// lists being rendered, innermost last, and paragraph the paragraph
+	// being rendered outside of any list.
+	items     []*pendingItem
+	lists     []*pendingList
+	paragraph *pendingItem
+}
 
 func NewLinkRenderer(flags int) blackfriday.Renderer {
 	return &LinkRenderer{}
 }
 
+// Links returns the links collected so far.
+func (l *LinkRenderer) Links() []Link {
+	return l.links
+}
+
 func (l *LinkRenderer) GetFlags() int {
 	return 0
 }
 
-func (l *LinkRenderer) Paragraph(out *bytes.Buffer, text func() bool) {
-	if text() {
-		out.WriteString("")
+// add records a link found below the current headings, as a link of the
+// item being rendered. A link outside of any item is an item of its own.
+func (l *LinkRenderer) add(link Link) {
+	link.Headings = append([]Heading(nil), l.headings...)
+	i := len(l.links)
+	l.links = append(l.links, link)
+
+	switch {
+	case len(l.lists) > 0:
+		p := l.lists[len(l.lists)-1].item()
+		p.links = append(p.links, i)
+	case l.paragraph != nil:
+		l.paragraph.links = append(l.paragraph.links, i)
+	default:
+		p := &pendingItem{item: Item{Headings: link.Headings}, links: []int{i}}
+		if !l.omitLinks {
+			p.text = link.Name
+		}
+		l.items = append(l.items, p)
+	}
+}
+
+// ref returns the id of the reference definition the link to location
+// being rendered was resolved through, or an empty string if it was not.
+// The text of a link is rendered before the link itself, so a link's id may
+// be pending below those of the links in its text; the innermost pending id
+// defined with location is the link's.
+func (l *LinkRenderer) ref(location []byte) string {
+	for i := len(l.pending) - 1; i >= 0; i-- {
+		id := l.pending[i]
+		defined := l.refs[strings.ToLower(id)]
+		if defined == string(location) || unescape(defined) == string(location) {
+			l.pending = append(l.pending[:i], l.pending[i+1:]...)
+			return id
+		}
 	}
+
+	return ""
+}
+
+// unescape removes the backslashes escaping punctuation in s, as
+// blackfriday does for link locations.
+func unescape(s string) string {
+	return backslashEscape.ReplaceAllString(s, "$1")
 }
 
-func (l *LinkRenderer) List(out *bytes.Buffer, text func() bool, flags int) {
-	if text() {
-		out.WriteString("")
+// referenceOverride notes when blackfriday resolves a link through one of
+// the document's reference definitions. It never overrides the definition.
+func (l *LinkRenderer) referenceOverride(id string) (*blackfriday.Reference, bool) {
+	if _, ok := l.refs[strings.ToLower(id)]; ok {
+		l.pending = append(l.pending, id)
 	}
+
+	return nil, false
 }
 
 func (l *LinkRenderer) Link(out *bytes.Buffer, link []byte, title []byte, content []byte) {
-	newLink := Link{
-		Name:     string(content),
+	ref := l.ref(link)
+	kind := Inline
+	if ref != "" {
+		kind = Reference
+	}
+	l.add(Link{
+		Name:     PlainText(content),
+		Location: string(link),
+		Title:    string(title),
+		Kind:     kind,
+		ref:      ref,
+	})
+	if !l.omitLinks {
+		out.Write(content)
+	}
+}
+
+func (l *LinkRenderer) Image(out *bytes.Buffer, link []byte, title []byte, alt []byte) {
+	l.add(Link{
+		Name:     PlainText(alt),
 		Location: string(link),
+		Title:    string(title),
+		Kind:     Image,
+		ref:      l.ref(link),
+	})
+	if !l.omitLinks {
+		out.Write(alt)
+	}
+}
+
+func (l *LinkRenderer) AutoLink(out *bytes.Buffer, link []byte, kind int) {
+	location := string(link)
+	if kind == blackfriday.LINK_TYPE_EMAIL && !strings.HasPrefix(location, "mailto:") {
+		location = "mailto:" + location
+	}
+	l.add(Link{
+		Name:     string(link),
+		Location: location,
+		Kind:     AutoLink,
+	})
+	if !l.omitLinks {
+		out.Write(link)
+	}
+}
+
+// RawHtmlTag turns inline <a href> anchors into links. The anchor's name is
+// whatever text is rendered before its closing tag.
+func (l *LinkRenderer) RawHtmlTag(out *bytes.Buffer, tag []byte) {
+	if closeAnchor.Match(tag) {
+		if l.anchor != nil && l.anchorStart <= out.Len() {
+			l.anchor.Name = PlainText(out.Bytes()[l.anchorStart:])
+			l.add(*l.anchor)
+			if l.omitLinks {
+				out.Truncate(l.anchorStart)
+			}
+		}
+		l.anchor = nil
+		return
+	}
+
+	if link, ok := parseAnchor(tag); ok {
+		l.anchor = &link
+		l.anchorStart = out.Len()
+	}
+}
+
+// BlockHtml extracts every <a href> anchor from a block of HTML.
+func (l *LinkRenderer) BlockHtml(out *bytes.Buffer, text []byte) {
+	for _, m := range anchorElement.FindAllSubmatch(text, -1) {
+		link, ok := parseAnchor(m[1])
+		if !ok {
+			continue
+		}
+		link.Name = PlainText([]byte(html.UnescapeString(string(htmlTag.ReplaceAll(m[2], nil)))))
+		l.add(link)
 	}
-	links = append(links, newLink)
+}
+
+// Header records the heading as the innermost enclosing section of every
+// link that follows it, closing any open sections of the same or a deeper
+// level.
+func (l *LinkRenderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	marker := out.Len()
+	if !text() {
+		out.Truncate(marker)
+		return
+	}
+	heading := Heading{
+		Text:  PlainText(out.Bytes()[marker:]),
+		Level: level,
+	}
+	out.Truncate(marker)
+
+	for len(l.headings) > 0 && l.headings[len(l.headings)-1].Level >= level {
+		l.headings = l.headings[:len(l.headings)-1]
+	}
+	l.headings = append(l.headings, heading)
 }
 
 func (l *LinkRenderer) NormalText(out *bytes.Buffer, text []byte) {
 	out.Write(text)
 }
 
+// Inline markup is rendered as its plain text so link names and headings
+// keep every word.
+
+func (l *LinkRenderer) CodeSpan(out *bytes.Buffer, text []byte) {
+	out.Write(text)
+}
+
+func (l *LinkRenderer) Emphasis(out *bytes.Buffer, text []byte) {
+	out.Write(text)
+}
+
+func (l *LinkRenderer) DoubleEmphasis(out *bytes.Buffer, text []byte) {
+	out.Write(text)
+}
+
+func (l *LinkRenderer) TripleEmphasis(out *bytes.Buffer, text []byte) {
+	out.Write(text)
+}
+
+func (l *LinkRenderer) StrikeThrough(out *bytes.Buffer, text []byte) {
+	out.Write(text)
+}
+
+func (l *LinkRenderer) LineBreak(out *bytes.Buffer) {
+	out.WriteByte(' ')
+}
+
+func (l *LinkRenderer) Entity(out *bytes.Buffer, entity []byte) {
+	out.WriteString(html.UnescapeString(string(entity)))
+}
+
+// PlainText collapses every run of whitespace in text, including line
+// breaks, into a single space and trims the result.
+func PlainText(text []byte) string {
+	return strings.Join(strings.Fields(string(text)), " ")
+}
+
 // Unused renderers.
 func (l *LinkRenderer) TitleBlock(out *bytes.Buffer, text []byte)                             {}
 func (l *LinkRenderer) BlockCode(out *bytes.Buffer, text []byte, lang string)                 {}
 func (l *LinkRenderer) BlockQuote(out *bytes.Buffer, text []byte)                             {}
-func (l *LinkRenderer) BlockHtml(out *bytes.Buffer, text []byte)                              {}
-func (l *LinkRenderer) Header(out *bytes.Buffer, text func() bool, level int, id string)      {}
 func (l *LinkRenderer) HRule(out *bytes.Buffer)                                               {}
-func (l *LinkRenderer) ListItem(out *bytes.Buffer, text []byte, flags int)                    {}
 func (l *LinkRenderer) Table(out *bytes.Buffer, header []byte, body []byte, columnData []int) {}
 func (l *LinkRenderer) TableRow(out *bytes.Buffer, text []byte)                               {}
 func (l *LinkRenderer) TableHeaderCell(out *bytes.Buffer, text []byte, align int)             {}
 func (l *LinkRenderer) TableCell(out *bytes.Buffer, text []byte, align int)                   {}
 func (l *LinkRenderer) Footnotes(out *bytes.Buffer, text func() bool)                         {}
 func (l *LinkRenderer) FootnoteItem(out *bytes.Buffer, name, text []byte, flags int)          {}
-func (l *LinkRenderer) AutoLink(out *bytes.Buffer, link []byte, kind int)                     {}
-func (l *LinkRenderer) CodeSpan(out *bytes.Buffer, text []byte)                               {}
-func (l *LinkRenderer) DoubleEmphasis(out *bytes.Buffer, text []byte)                         {}
-func (l *LinkRenderer) Emphasis(out *bytes.Buffer, text []byte)                               {}
-func (l *LinkRenderer) Image(out *bytes.Buffer, link []byte, title []byte, alt []byte)        {}
-func (l *LinkRenderer) LineBreak(out *bytes.Buffer)                                           {}
-func (l *LinkRenderer) RawHtmlTag(out *bytes.Buffer, tag []byte)                              {}
-func (l *LinkRenderer) TripleEmphasis(out *bytes.Buffer, text []byte)                         {}
-func (l *LinkRenderer) StrikeThrough(out *bytes.Buffer, text []byte)                          {}
 func (l *LinkRenderer) FootnoteRef(out *bytes.Buffer, ref []byte, id int)                     {}
-func (l *LinkRenderer) Entity(out *bytes.Buffer, entity []byte)                               {}
 func (l *LinkRenderer) DocumentHeader(out *bytes.Buffer)                                      {}
 func (l *LinkRenderer) DocumentFooter(out *bytes.Buffer)                                      {}
 
-func Links(markdown []byte) []Link {
-	// Clear global links slice on each invocation.
-	links = nil
+var (
+	anchorElement = regexp.MustCompile(`(?is)(<a\s[^>]*>)(.*?)</a\s*>`)
+	anchorHref    = regexp.MustCompile(`(?is)\shref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	anchorTitle   = regexp.MustCompile(`(?is)\stitle\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	closeAnchor   = regexp.MustCompile(`(?i)^</a\s*>$`)
+	openAnchor    = regexp.MustCompile(`(?i)^<a\s`)
+	htmlTag       = regexp.MustCompile(`<[^>]*>`)
+
+	// refLocation matches a reference definition and its location, which
+	// may be on the next line and in angle brackets.
+	refLocation     = regexp.MustCompile(`(?m)^ {0,3}\[([^\]]+)\]:[ \t]*(?:\r?\n[ \t]*)?<?([^\s>]*)`)
+	backslashEscape = regexp.MustCompile("\\\\([!-/:-@[-`{-~])")
+)
+
+// parseAnchor returns the link described by an <a> start tag. It returns
+// false if tag is not an anchor with an href.
+func parseAnchor(tag []byte) (Link, bool) {
+	if !openAnchor.Match(tag) {
+		return Link{}, false
+	}
+	href := attribute(anchorHref, tag)
+	if href == "" {
+		return Link{}, false
+	}
+
+	return Link{
+		Location: href,
+		Title:    attribute(anchorTitle, tag),
+		Kind:     HTML,
+	}, true
+}
+
+// attribute returns the unescaped value of the attribute matched by re.
+func attribute(re *regexp.Regexp, tag []byte) string {
+	m := re.FindSubmatch(tag)
+	if m == nil {
+		return ""
+	}
+
+	return html.UnescapeString(string(bytes.Join(m[1:], nil)))
+}
+
+// Extractor extracts links from markdown documents. Every call to Links
+// uses its own renderer, so an Extractor is safe for concurrent use.
+type Extractor struct {
+	// Extensions are the blackfriday EXTENSION_* flags used when parsing.
+	Extensions int
+
+	// Kinds limits the links returned to those of the given kinds. If
+	// empty, links of every kind are returned.
+	Kinds []Kind
+
+	// Markers annotates the links. If nil, links are not annotated.
+	Markers *MarkerRegistry
+}
+
+// NewExtractor returns an Extractor returning links of the given kinds, or
+// of every kind if none are given. Bare URLs are recognised as autolinks
+// and links are annotated with the DefaultMarkers.
+func NewExtractor(kinds ...Kind) *Extractor {
+	return &Extractor{
+		Extensions: blackfriday.EXTENSION_AUTOLINK,
+		Kinds:      kinds,
+		Markers:    DefaultMarkers,
+	}
+}
+
+// Links returns every link found in markdown, in document order.
+func (e *Extractor) Links(markdown []byte) []Link {
+	links := e.render(markdown, false).Links()
+	locate(markdown, links)
+	if e.Markers != nil {
+		e.Markers.Annotate(markdown, links)
+	}
 
-	l := NewLinkRenderer(0)
-	_ = blackfriday.Markdown(markdown, l, 0)
+	return FilterKinds(links, e.Kinds...)
+}
+
+// render renders markdown with a LinkRenderer of its own, leaving links
+// out of the output if omitLinks is set, and returns the renderer.
+func (e *Extractor) render(markdown []byte, omitLinks bool) *LinkRenderer {
+	l := &LinkRenderer{refs: make(map[string]string), omitLinks: omitLinks}
+	for _, m := range refLocation.FindAllSubmatch(markdown, -1) {
+		l.refs[strings.ToLower(string(m[1]))] = string(m[2])
+	}
+
+	_ = blackfriday.MarkdownOptions(markdown, l, blackfriday.Options{
+		Extensions:        e.Extensions,
+		ReferenceOverride: l.referenceOverride,
+	})
+
+	return l
+}
+
+// FilterKinds returns the links of the given kinds. If no kinds are given
+// links is returned unchanged.
+func FilterKinds(links []Link, kinds ...Kind) []Link {
+	if len(kinds) == 0 {
+		return links
+	}
+
+	var filtered []Link
+	for _, link := range links {
+		for _, kind := range kinds {
+			if link.Kind == kind {
+				filtered = append(filtered, link)
+				break
+			}
+		}
+	}
 
-	return links
+	return filtered
+}
+
+var defaultExtractor = NewExtractor()
+
+// Links returns every link of every kind found in markdown. It is a
+// shorthand for NewExtractor().Links(markdown).
+func Links(markdown []byte) []Link {
+	return defaultExtractor.Links(markdown)
 }
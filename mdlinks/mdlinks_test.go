@@ -0,0 +1,76 @@
+package mdlinks
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+var concurrentDocuments = []string{
+	"# Distributed Systems\n\n* [Paxos Made Simple](paxos.pdf) :scroll:\n* [Raft][raft] by Ongaro, 2014\n\n[raft]: https://raft.github.io/raft.pdf\n",
+	"## Papers\n\nSee <https://example.org/a.pdf> and <a href=\"b.pdf\">the *B* paper</a>.\n\n![badge](badge.svg)\n",
+	"* [Dynamo](dynamo.pdf)\n  * [Talk](https://youtube.com/watch?v=1)\n* [`Bigtable`](bigtable.pdf)\n",
+}
+
+// TestExtractorConcurrentLinks calls one Extractor from many goroutines and
+// checks every call returns what a call on its own does. Run it with -race.
+func TestExtractorConcurrentLinks(t *testing.T) {
+	extractor := NewExtractor()
+	extractor.Markers = DefaultMarkers.With(Marker{Text: ":scroll:", Annotation: SelfHosted})
+
+	want := make([][]Link, len(concurrentDocuments))
+	for i, doc := range concurrentDocuments {
+		want[i] = extractor.Links([]byte(doc))
+	}
+
+	const goroutines = 16
+	const iterations = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < iterations; n++ {
+				i := (g + n) % len(concurrentDocuments)
+				if got := extractor.Links([]byte(concurrentDocuments[i])); !reflect.DeepEqual(got, want[i]) {
+					errs <- fmt.Errorf("document %d: got %+v, want %+v", i, got, want[i])
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestExtractorConcurrentRegister registers markers while links are being
+// extracted with them. Run it with -race.
+func TestExtractorConcurrentRegister(t *testing.T) {
+	extractor := NewExtractor()
+	extractor.Markers = DefaultMarkers.With()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			extractor.Markers.Register(Marker{Text: fmt.Sprintf(":m%d:", g), Annotation: HasVideo})
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			extractor.Links([]byte(concurrentDocuments[g%len(concurrentDocuments)]))
+		}(g)
+	}
+	wg.Wait()
+
+	if got := len(extractor.Markers.Markers()); got < 8 {
+		t.Errorf("got %d markers, want at least 8", got)
+	}
+}
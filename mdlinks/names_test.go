@@ -0,0 +1,53 @@
+package mdlinks
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestLinkNames checks the names of the links in each testdata/names/*.md
+// file against its .golden file, which lists one link per line as its kind
+// and name separated by a tab. Run with -update to rewrite the golden files.
+func TestLinkNames(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "names", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no test inputs")
+	}
+
+	for _, input := range inputs {
+		markdown, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got strings.Builder
+		for _, link := range Links(markdown) {
+			fmt.Fprintf(&got, "%s\t%s\n", link.Kind, link.Name)
+		}
+
+		golden := strings.TrimSuffix(input, ".md") + ".golden"
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(got.String()), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != string(want) {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", input, got.String(), want)
+		}
+	}
+}
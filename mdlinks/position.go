@@ -0,0 +1,153 @@
+package mdlinks
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// locate sets the source position of every link. Blackfriday works on
+// copies of the input, so positions are recovered by searching the source
+// for each link's syntax in document order, starting after the previous
+// match. Reference links are found by the id they were resolved through.
+// Blackfriday removes backslash escapes from locations, so any character of
+// a location may be escaped in the source. Links that can not be found
+// after the previous match keep a zero position.
+func locate(source []byte, links []Link) {
+	cursor := 0
+	for i := range links {
+		link := &links[i]
+
+		var needles []string
+		switch {
+		case link.ref != "":
+			ref := regexp.QuoteMeta(link.ref)
+			needles = []string{`\]\[` + ref + `\]`, `\[` + ref + `\]`}
+		case link.Kind == Inline, link.Kind == Image:
+			location := escaped(link.Location)
+			needles = []string{`\(` + location, `\(<` + location, location}
+		case link.Kind == Reference:
+			needles = []string{escaped(firstWord(link.Name))}
+		case link.Kind == AutoLink:
+			needles = []string{escaped(link.Name)}
+		default:
+			needles = []string{escaped(link.Location)}
+		}
+
+		at, n := find(source, cursor, needles)
+		if at < 0 {
+			continue
+		}
+		cursor = at + n
+
+		syntax := link.Kind
+		if link.ref != "" {
+			syntax = Reference
+		}
+		link.Offset = start(source, at, syntax)
+		link.Line, link.Column = lineColumn(source, link.Offset)
+	}
+}
+
+// find returns the offset and length of the first match of the first of
+// needles, regular expressions, found in source after cursor. It returns -1
+// if none of them are found.
+func find(source []byte, cursor int, needles []string) (int, int) {
+	for _, needle := range needles {
+		if needle == "" {
+			continue
+		}
+		if loc := regexp.MustCompile(needle).FindIndex(source[cursor:]); loc != nil {
+			return cursor + loc[0], loc[1] - loc[0]
+		}
+	}
+
+	return -1, 0
+}
+
+// escaped returns a regular expression matching s with any of its
+// characters backslash escaped.
+func escaped(s string) string {
+	var re strings.Builder
+	for _, r := range s {
+		re.WriteString(`\\?`)
+		re.WriteString(regexp.QuoteMeta(string(r)))
+	}
+
+	return re.String()
+}
+
+// start returns the offset a link of the given kind starts at, given the
+// offset of its needle.
+func start(source []byte, at int, kind Kind) int {
+	s := at
+	switch kind {
+	case Inline, Image:
+		if close := bytes.LastIndex(source[:at+1], []byte("](")); close >= 0 {
+			s = openBracket(source, close)
+		}
+	case Reference:
+		// The needle is the "][id]" ending a full reference, the "[id]"
+		// of a collapsed or shortcut reference, or a word of the name.
+		switch source[at] {
+		case ']':
+			s = openBracket(source, at)
+		case '[':
+		default:
+			line := bytes.LastIndexByte(source[:at], '\n') + 1
+			if open := bytes.LastIndexByte(source[line:at], '['); open >= 0 {
+				s = line + open
+			}
+		}
+	case HTML:
+		if open := bytes.LastIndex(bytes.ToLower(source[:at]), []byte("<a")); open >= 0 {
+			s = open
+		}
+	case AutoLink:
+		if at > 0 && source[at-1] == '<' {
+			s = at - 1
+		}
+	}
+
+	if (kind == Image || kind == Reference) && s > 0 && source[s-1] == '!' {
+		s--
+	}
+
+	return s
+}
+
+// openBracket returns the offset of the "[" matching the "]" at close.
+func openBracket(source []byte, close int) int {
+	depth := 0
+	for i := close; i >= 0; i-- {
+		switch source[i] {
+		case ']':
+			depth++
+		case '[':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return close
+}
+
+// lineColumn returns the 1-based line and column, counted in characters, of
+// offset in source.
+func lineColumn(source []byte, offset int) (int, int) {
+	line := 1 + bytes.Count(source[:offset], []byte("\n"))
+	lineStart := bytes.LastIndexByte(source[:offset], '\n') + 1
+
+	return line, 1 + utf8.RuneCount(source[lineStart:offset])
+}
+
+func firstWord(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[0]
+}
@@ -0,0 +1,82 @@
+package mdlinks
+
+import "testing"
+
+func TestLinkPositions(t *testing.T) {
+	tests := []struct {
+		markdown string
+		want     []Link
+	}{
+		{
+			"* [Raft](raft.pdf) - consensus\n* Consensus: [Consensus Survey][cs]\n\n[cs]: survey.pdf\n",
+			[]Link{
+				{Name: "Raft", Line: 1, Column: 3},
+				{Name: "Consensus Survey", Line: 2, Column: 14},
+			},
+		},
+		{
+			"See [Paxos][] and [Chubby].\n\n[paxos]: paxos.pdf\n[chubby]: chubby.pdf\n",
+			[]Link{
+				{Name: "Paxos", Line: 1, Column: 5},
+				{Name: "Chubby", Line: 1, Column: 19},
+			},
+		},
+		{
+			"[a](x.pdf) [b][x]\n\n[x]: x.pdf\n",
+			[]Link{
+				{Name: "a", Line: 1, Column: 1},
+				{Name: "b", Line: 1, Column: 12},
+			},
+		},
+		{
+			"[Spanner] ![badge][b]\n\n[spanner]: spanner.pdf\n[b]: badge.svg\n",
+			[]Link{
+				{Name: "Spanner", Line: 1, Column: 1},
+				{Name: "badge", Line: 1, Column: 11},
+			},
+		},
+		{
+			"* [x](a\\_b.pdf) and [y](a_b.pdf)\n* <https://example.org/a\\_b> [z](<c\\(1\\).pdf>)\n",
+			[]Link{
+				{Name: "x", Line: 1, Column: 3},
+				{Name: "y", Line: 1, Column: 21},
+				{Name: "https://example.org/a_b", Line: 2, Column: 3},
+				{Name: "z", Line: 2, Column: 30},
+			},
+		},
+		{
+			"[![Build Status][badge]][ci]\n\n[badge]: badge.svg\n[ci]: https://ci.example.org/\n",
+			[]Link{
+				{Name: "Build Status", Line: 1, Column: 2},
+				{Name: "Build Status", Line: 1, Column: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		links := Links([]byte(test.markdown))
+		if len(links) != len(test.want) {
+			t.Errorf("%q: got %d links, want %d", test.markdown, len(links), len(test.want))
+			continue
+		}
+		for i, want := range test.want {
+			got := links[i]
+			if got.Name != want.Name || got.Line != want.Line || got.Column != want.Column {
+				t.Errorf("%q: link %d = %q at L%d C%d, want %q at L%d C%d",
+					test.markdown, i, got.Name, got.Line, got.Column, want.Name, want.Line, want.Column)
+			}
+		}
+	}
+}
+
+func TestItemsReferenceLinks(t *testing.T) {
+	items := Items([]byte("* [Raft](raft.pdf) - consensus\n* Consensus: [Consensus Survey][cs]\n\n[cs]: survey.pdf\n"))
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	for i, name := range []string{"Raft", "Consensus Survey"} {
+		if len(items[i].Links) != 1 || items[i].Links[0].Name != name {
+			t.Errorf("item %d has links %+v, want only %q", i, items[i].Links, name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/imwally/love-a-paper/pdfmeta"
+)
+
+// SourceReadme marks a Paper field taken from the README link text.
+const SourceReadme = "readme"
+
+// FieldSources records where each descriptive field of a Paper came from.
+// Fields that are unknown have no source.
+type FieldSources struct {
+	Name    string `json:"name,omitempty"`
+	Authors string `json:"authors,omitempty"`
+	Year    string `json:"year,omitempty"`
+}
+
+// String lists the source of every known field, e.g. "name from xmp, year
+// from readme".
+func (s FieldSources) String() string {
+	var parts []string
+	for _, field := range []struct{ name, source string }{
+		{"name", s.Name},
+		{"authors", s.Authors},
+		{"year", s.Year},
+	} {
+		if field.source != "" {
+			parts = append(parts, field.name+" from "+field.source)
+		}
+	}
+	if len(parts) == 0 {
+		return "no sources"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// waybackSnapshot matches a Wayback Machine snapshot URL up to its
+// timestamp.
+var waybackSnapshot = regexp.MustCompile(`^(https?://web\.archive\.org/web/\d+)/`)
+
+// rawResolver rewrites Github file links to their raw content.
+var rawResolver = NewResolver(BlobRaw)
+
+// MetadataFetcher downloads PDFs and reads their metadata.
+type MetadataFetcher struct {
+	// MaxSize is the largest PDF, in bytes, that is downloaded.
+	MaxSize int64
+
+	client *http.Client
+}
+
+// NewMetadataFetcher returns a MetadataFetcher whose downloads time out
+// after timeout and are abandoned once they exceed maxSize bytes.
+func NewMetadataFetcher(timeout time.Duration, maxSize int64) *MetadataFetcher {
+	return &MetadataFetcher{
+		MaxSize: maxSize,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Fetch downloads the PDF at link and returns its metadata. Github file
+// pages and Wayback Machine snapshots are fetched as raw files.
+func (f *MetadataFetcher) Fetch(link string) (*pdfmeta.Metadata, error) {
+	link, err := rawResolver.Resolve(nil, link)
+	if err != nil {
+		return nil, err
+	}
+	link = waybackSnapshot.ReplaceAllString(link, "${1}id_/")
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", link, resp.Status)
+	}
+	if resp.ContentLength > f.MaxSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", link, f.MaxSize)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.MaxSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", link, f.MaxSize)
+	}
+
+	return pdfmeta.Parse(data)
+}
+
+// ApplyMetadata fills paper from meta, preferring the PDF's own title over
+// the README link text and recording where each field came from. The year
+// is only taken from the PDF when the README gave none, as a PDF's creation
+// date is often when it was scanned or uploaded.
+func ApplyMetadata(paper *Paper, meta *pdfmeta.Metadata) {
+	if meta.Title != "" {
+		paper.Name = meta.Title
+		paper.Sources.Name = string(meta.TitleSource)
+	}
+	if len(meta.Authors) > 0 {
+		paper.Authors = meta.Authors
+		paper.Sources.Authors = string(meta.AuthorsSource)
+	}
+	if meta.Year != 0 && paper.Year == 0 {
+		paper.Year = meta.Year
+		paper.Sources.Year = string(meta.YearSource)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/imwally/love-a-paper/pdfmeta"
+)
+
+func TestApplyMetadata(t *testing.T) {
+	meta := &pdfmeta.Metadata{
+		Title: "Paxos Made Simple", TitleSource: pdfmeta.SourceXMP,
+		Authors: []string{"Leslie Lamport"}, AuthorsSource: pdfmeta.SourceInfo,
+		Year: 2019, YearSource: pdfmeta.SourceInfo,
+	}
+	tests := []struct {
+		name       string
+		year       int
+		wantYear   int
+		wantSource string
+	}{
+		{"readme year kept", 2001, 2001, SourceReadme},
+		{"pdf year used", 0, 2019, string(pdfmeta.SourceInfo)},
+	}
+
+	for _, test := range tests {
+		paper := &Paper{Name: "Paxos", Year: test.year, Sources: FieldSources{Name: SourceReadme}}
+		if test.year != 0 {
+			paper.Sources.Year = SourceReadme
+		}
+		ApplyMetadata(paper, meta)
+
+		if paper.Year != test.wantYear || paper.Sources.Year != test.wantSource {
+			t.Errorf("%s: year %d from %q, want %d from %q", test.name, paper.Year, paper.Sources.Year, test.wantYear, test.wantSource)
+		}
+		if paper.Name != meta.Title || paper.Sources.Name != string(pdfmeta.SourceXMP) {
+			t.Errorf("%s: name %q from %q, want the PDF title", test.name, paper.Name, paper.Sources.Name)
+		}
+		if len(paper.Authors) != 1 || paper.Sources.Authors != string(pdfmeta.SourceInfo) {
+			t.Errorf("%s: authors %q from %q, want the PDF authors", test.name, paper.Authors, paper.Sources.Authors)
+		}
+	}
+}
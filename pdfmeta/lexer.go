@@ -0,0 +1,280 @@
+package pdfmeta
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// PDF object types produced by the lexer.
+type (
+	name      string
+	pdfString []byte
+	dict      map[string]interface{}
+	array     []interface{}
+	ref       struct{ num, gen int }
+	keyword   string
+	stream    struct {
+		dict dict
+		data []byte
+	}
+)
+
+var errSyntax = errors.New("pdf syntax error")
+
+// maxDepth limits how deeply arrays and dictionaries may nest.
+const maxDepth = 32
+
+// lexer reads PDF objects from data starting at pos.
+type lexer struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func isSpace(b byte) bool {
+	switch b {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+
+	return false
+}
+
+func isDelim(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+
+	return false
+}
+
+// skipSpace skips whitespace and comments.
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch {
+		case isSpace(l.data[l.pos]):
+			l.pos++
+		case l.data[l.pos] == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// value reads the next object. Integers followed by a generation number and
+// "R" are returned as indirect references.
+func (l *lexer) value() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errSyntax
+	}
+
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		l.pos++
+		return name(l.regular()), nil
+	case c == '(':
+		l.pos++
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return l.dict()
+	case c == '<':
+		l.pos++
+		return l.hexString()
+	case c == '[':
+		l.pos++
+		return l.array()
+	case c == ']' || c == '>' || c == ')':
+		return nil, errSyntax
+	}
+
+	word := l.regular()
+	if word == "" {
+		l.pos++
+		return nil, errSyntax
+	}
+	if i, err := strconv.Atoi(word); err == nil {
+		return l.maybeRef(i), nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	return keyword(word), nil
+}
+
+// regular reads a run of regular characters.
+func (l *lexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+
+	return string(l.data[start:l.pos])
+}
+
+// maybeRef returns a ref if num is followed by a generation number and "R",
+// and num otherwise.
+func (l *lexer) maybeRef(num int) interface{} {
+	save := l.pos
+	l.skipSpace()
+	gen, err := strconv.Atoi(l.regular())
+	if err == nil {
+		l.skipSpace()
+		if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+			(l.pos+1 == len(l.data) || isSpace(l.data[l.pos+1]) || isDelim(l.data[l.pos+1])) {
+			l.pos++
+			return ref{num, gen}
+		}
+	}
+	l.pos = save
+
+	return num
+}
+
+func (l *lexer) dict() (interface{}, error) {
+	if l.depth++; l.depth > maxDepth {
+		return nil, errSyntax
+	}
+	defer func() { l.depth-- }()
+
+	d := make(dict)
+	for {
+		l.skipSpace()
+		if bytes.HasPrefix(l.data[l.pos:], []byte(">>")) {
+			l.pos += 2
+			return d, nil
+		}
+
+		key, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(name)
+		if !ok {
+			return nil, errSyntax
+		}
+		v, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		d[string(k)] = v
+	}
+}
+
+func (l *lexer) array() (interface{}, error) {
+	if l.depth++; l.depth > maxDepth {
+		return nil, errSyntax
+	}
+	defer func() { l.depth-- }()
+
+	var a array
+	for {
+		l.skipSpace()
+		if l.pos < len(l.data) && l.data[l.pos] == ']' {
+			l.pos++
+			return a, nil
+		}
+
+		v, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+}
+
+func (l *lexer) literalString() (interface{}, error) {
+	var buf []byte
+	nesting := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			nesting++
+		case ')':
+			if nesting--; nesting == 0 {
+				return pdfString(buf), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, errSyntax
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v := int(c - '0')
+				for i := 0; i < 2 && l.pos < len(l.data) && '0' <= l.data[l.pos] && l.data[l.pos] <= '7'; i++ {
+					v = v*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				c = byte(v)
+			}
+		}
+		buf = append(buf, c)
+	}
+
+	return nil, errSyntax
+}
+
+func (l *lexer) hexString() (interface{}, error) {
+	var digits []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch {
+		case c == '>':
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			buf := make([]byte, len(digits)/2)
+			for i := range buf {
+				v, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+				buf[i] = byte(v)
+			}
+			return pdfString(buf), nil
+		case isSpace(c):
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+			digits = append(digits, c)
+		default:
+			return nil, errSyntax
+		}
+	}
+
+	return nil, errSyntax
+}
@@ -0,0 +1,456 @@
+package pdfmeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Source tells where a metadata field was read from.
+type Source string
+
+const (
+	SourceInfo Source = "pdf info"
+	SourceXMP  Source = "xmp"
+)
+
+// Metadata is the document metadata of a PDF. Each field records the Source
+// it came from; fields that were not found are left empty.
+type Metadata struct {
+	Title         string
+	TitleSource   Source
+	Authors       []string
+	AuthorsSource Source
+	Year          int
+	YearSource    Source
+}
+
+// ErrNotPDF is returned by Parse when data does not start with a PDF
+// header.
+var ErrNotPDF = errors.New("not a PDF")
+
+var (
+	// errCycle is returned for an object whose stream length refers back
+	// to an object that is being resolved.
+	errCycle = errors.New("reference cycle")
+
+	// errTooLarge is returned for a stream that inflates to more than
+	// maxDecoded bytes.
+	errTooLarge = errors.New("stream too large")
+)
+
+// maxDecoded is the most a stream is inflated to.
+const maxDecoded = 16 << 20
+
+var (
+	infoRef     = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	rootRef     = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	objHeader   = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	yearPattern = regexp.MustCompile(`(1[89]\d\d|20\d\d)`)
+	junkTitle   = regexp.MustCompile(`(?i)^(untitled|title|microsoft word\b.*|.*\.(pdf|dvi|ps|docx?|tex))$`)
+)
+
+// Parse reads the Info dictionary and XMP metadata of the PDF in data. XMP
+// values are preferred over Info values when both are present.
+func Parse(data []byte) (*Metadata, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+
+	d := &document{
+		data:      data,
+		resolving: make(map[int]bool),
+		objStms:   make(map[int][]byte),
+	}
+	d.indexObjects()
+	meta := &Metadata{}
+	d.readXMP(meta)
+	d.readInfo(meta)
+
+	return meta, nil
+}
+
+// document is a PDF file read just far enough to find its metadata.
+type document struct {
+	data []byte
+
+	// offsets holds where the "obj" keyword of each object header ends,
+	// in file order, and headers the same positions for every object.
+	offsets map[ref][]int
+	headers []int
+
+	// resolving holds the objects being resolved, so references that
+	// lead back to them are not followed.
+	resolving map[int]bool
+
+	// objStms holds the objects found in the object streams inflated so
+	// far, and pending the positions of the object streams not inflated
+	// yet, once scanned is set.
+	objStms map[int][]byte
+	pending []int
+	scanned bool
+}
+
+// indexObjects records the position of every object header in a single
+// scan of the file. The cross-reference table is not used, so files with a
+// damaged one can still be read.
+func (d *document) indexObjects() {
+	d.offsets = make(map[ref][]int)
+	for _, loc := range objHeader.FindAllSubmatchIndex(d.data, -1) {
+		if loc[0] > 0 && isDigit(d.data[loc[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(d.data[loc[2]:loc[3]]))
+		gen, _ := strconv.Atoi(string(d.data[loc[4]:loc[5]]))
+		r := ref{num, gen}
+		d.offsets[r] = append(d.offsets[r], loc[1])
+		d.headers = append(d.headers, loc[1])
+	}
+}
+
+// readInfo fills any fields of meta that are still empty from the Info
+// dictionary named by the (last) trailer.
+func (d *document) readInfo(meta *Metadata) {
+	info, ok := d.resolve(lastRef(infoRef, d.data)).(dict)
+	if !ok {
+		return
+	}
+
+	if meta.Title == "" {
+		if title := cleanTitle(d.text(info["Title"])); title != "" {
+			meta.Title, meta.TitleSource = title, SourceInfo
+		}
+	}
+	if len(meta.Authors) == 0 {
+		if authors := SplitAuthors(d.text(info["Author"])); len(authors) > 0 {
+			meta.Authors, meta.AuthorsSource = authors, SourceInfo
+		}
+	}
+	if meta.Year == 0 {
+		if year := ParseYear(d.text(info["CreationDate"])); year != 0 {
+			meta.Year, meta.YearSource = year, SourceInfo
+		}
+	}
+}
+
+// readXMP fills meta from the document's XMP packet. The packet referenced
+// by the document catalog is used if it can be found, otherwise the first
+// packet in the file.
+func (d *document) readXMP(meta *Metadata) {
+	var packet []byte
+	if root, ok := d.resolve(lastRef(rootRef, d.data)).(dict); ok {
+		if r, ok := root["Metadata"].(ref); ok {
+			if s, ok := d.object(r.num, r.gen).(stream); ok {
+				packet = s.data
+			}
+		}
+	}
+	if packet == nil {
+		start := bytes.Index(d.data, []byte("<x:xmpmeta"))
+		if start < 0 {
+			return
+		}
+		end := bytes.Index(d.data[start:], []byte("</x:xmpmeta>"))
+		if end < 0 {
+			return
+		}
+		packet = d.data[start : start+end+len("</x:xmpmeta>")]
+	}
+
+	x := parseXMP(packet)
+	if title := cleanTitle(x.title); title != "" {
+		meta.Title, meta.TitleSource = title, SourceXMP
+	}
+	var authors []string
+	for _, creator := range x.creators {
+		authors = append(authors, SplitAuthors(creator)...)
+	}
+	if len(authors) > 0 {
+		meta.Authors, meta.AuthorsSource = authors, SourceXMP
+	}
+	if year := ParseYear(x.date); year != 0 {
+		meta.Year, meta.YearSource = year, SourceXMP
+	}
+}
+
+// lastRef returns the last indirect reference matched by re in data, or a
+// zero ref if there is none. Incremental updates append trailers, so the
+// last one is the current one.
+func lastRef(re *regexp.Regexp, data []byte) ref {
+	matches := re.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return ref{}
+	}
+	m := matches[len(matches)-1]
+	num, _ := strconv.Atoi(string(m[1]))
+	gen, _ := strconv.Atoi(string(m[2]))
+
+	return ref{num, gen}
+}
+
+// resolve follows v if it is an indirect reference.
+func (d *document) resolve(v interface{}) interface{} {
+	r, ok := v.(ref)
+	if !ok {
+		return v
+	}
+	if r.num == 0 {
+		return nil
+	}
+
+	return d.object(r.num, r.gen)
+}
+
+// text resolves v and decodes it as a PDF text string.
+func (d *document) text(v interface{}) string {
+	s, ok := d.resolve(v).(pdfString)
+	if !ok {
+		return ""
+	}
+
+	return DecodeText(s)
+}
+
+// object returns the value of object num, looking in object streams if it
+// is not stored directly in the file. Incremental updates append new
+// versions of objects, so the last one that parses is used. An object that
+// is already being resolved is nil.
+func (d *document) object(num, gen int) interface{} {
+	if d.resolving[num] {
+		return nil
+	}
+	d.resolving[num] = true
+	defer delete(d.resolving, num)
+
+	offsets := d.offsets[ref{num, gen}]
+	for i := len(offsets) - 1; i >= 0; i-- {
+		if v, err := d.objectAt(offsets[i]); err == nil && v != nil {
+			return v
+		}
+	}
+
+	return d.compressedObject(num)
+}
+
+// objectAt parses the object whose "obj" keyword ends at pos, including its
+// stream if it has one.
+func (d *document) objectAt(pos int) (interface{}, error) {
+	v, raw, err := d.rawObjectAt(pos)
+	if err != nil || raw == nil {
+		return v, err
+	}
+
+	h := v.(dict)
+	data, err := decode(h, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream{h, data}, nil
+}
+
+// rawObjectAt parses the object whose "obj" keyword ends at pos. If the
+// object is a stream its data is returned undecoded, otherwise raw is nil.
+func (d *document) rawObjectAt(pos int) (v interface{}, raw []byte, err error) {
+	l := &lexer{data: d.data, pos: pos}
+	v, err = l.value()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h, ok := v.(dict)
+	if !ok {
+		return v, nil, nil
+	}
+	l.skipSpace()
+	if !bytes.HasPrefix(d.data[l.pos:], []byte("stream")) {
+		return v, nil, nil
+	}
+
+	start := l.pos + len("stream")
+	if start < len(d.data) && d.data[start] == '\r' {
+		start++
+	}
+	if start < len(d.data) && d.data[start] == '\n' {
+		start++
+	}
+
+	if r, ok := h["Length"].(ref); ok && d.resolving[r.num] {
+		return nil, nil, errCycle
+	}
+	end := -1
+	if length, ok := d.resolve(h["Length"]).(int); ok && length >= 0 && start+length <= len(d.data) {
+		end = start + length
+	} else if i := bytes.Index(d.data[start:], []byte("endstream")); i >= 0 {
+		end = start + i
+	}
+	if end < 0 {
+		return nil, nil, errors.New("unterminated stream")
+	}
+
+	return h, d.data[start:end], nil
+}
+
+// compressedObject looks for object num in the document's object streams.
+// They are inflated one at a time, in file order, until one holds num.
+func (d *document) compressedObject(num int) interface{} {
+	if !d.scanned {
+		d.scanned = true
+		for _, pos := range d.headers {
+			l := &lexer{data: d.data, pos: pos}
+			if h, err := l.value(); err == nil {
+				if h, ok := h.(dict); ok && h["Type"] == name("ObjStm") {
+					d.pending = append(d.pending, pos)
+				}
+			}
+		}
+	}
+
+	for {
+		if data, ok := d.objStms[num]; ok {
+			l := &lexer{data: data}
+			v, err := l.value()
+			if err != nil {
+				return nil
+			}
+			return v
+		}
+		if len(d.pending) == 0 {
+			return nil
+		}
+
+		pos := d.pending[0]
+		d.pending = d.pending[1:]
+		if v, err := d.objectAt(pos); err == nil {
+			if s, ok := v.(stream); ok {
+				d.indexObjStm(s)
+			}
+		}
+	}
+}
+
+// indexObjStm records where each object in an object stream starts.
+func (d *document) indexObjStm(s stream) {
+	n, _ := s.dict["N"].(int)
+	first, _ := s.dict["First"].(int)
+	if first > len(s.data) {
+		return
+	}
+
+	l := &lexer{data: s.data[:first]}
+	for i := 0; i < n; i++ {
+		num, err1 := l.value()
+		offset, err2 := l.value()
+		if err1 != nil || err2 != nil {
+			return
+		}
+		o, ok1 := num.(int)
+		off, ok2 := offset.(int)
+		if !ok1 || !ok2 || first+off > len(s.data) {
+			return
+		}
+		d.objStms[o] = s.data[first+off:]
+	}
+}
+
+// decode applies the stream's filters. Only FlateDecode is supported, which
+// is all metadata and object streams use in practice.
+func decode(h dict, data []byte) ([]byte, error) {
+	var filters []interface{}
+	switch f := h["Filter"].(type) {
+	case name:
+		filters = []interface{}{f}
+	case array:
+		filters = f
+	}
+
+	for _, f := range filters {
+		if f != name("FlateDecode") {
+			return nil, errors.New("unsupported filter")
+		}
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(io.LimitReader(r, maxDecoded+1))
+		if err != nil && len(data) == 0 {
+			return nil, err
+		}
+		if len(data) > maxDecoded {
+			return nil, errTooLarge
+		}
+	}
+
+	return data, nil
+}
+
+// DecodeText decodes a PDF text string, which is UTF-16BE when it starts
+// with a byte order mark and PDFDocEncoding otherwise. PDFDocEncoding is
+// treated as Latin-1, which it matches for printable characters.
+func DecodeText(s []byte) string {
+	switch {
+	case len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff:
+		u := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return strings.TrimSpace(string(utf16.Decode(u)))
+	case len(s) >= 3 && s[0] == 0xef && s[1] == 0xbb && s[2] == 0xbf:
+		return strings.TrimSpace(string(s[3:]))
+	}
+
+	r := make([]rune, len(s))
+	for i, b := range s {
+		r[i] = rune(b)
+	}
+
+	return strings.TrimSpace(string(r))
+}
+
+// ParseYear returns the first plausible year in a PDF or XMP date, or zero.
+func ParseYear(date string) int {
+	m := yearPattern.FindString(date)
+	if m == "" {
+		return 0
+	}
+	year, _ := strconv.Atoi(m)
+
+	return year
+}
+
+// SplitAuthors splits an author field into individual names. Names are
+// separated by semicolons, "and" or ampersands.
+func SplitAuthors(s string) []string {
+	s = strings.NewReplacer(" and ", ";", "&", ";", "\n", ";").Replace(s)
+
+	var authors []string
+	for _, author := range strings.Split(s, ";") {
+		author = strings.Join(strings.Fields(author), " ")
+		if author != "" {
+			authors = append(authors, author)
+		}
+	}
+
+	return authors
+}
+
+// cleanTitle collapses whitespace in title and drops titles that are
+// clearly placeholders or file names left behind by authoring tools.
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if junkTitle.MatchString(title) {
+		return ""
+	}
+
+	return title
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
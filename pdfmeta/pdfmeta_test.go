@@ -0,0 +1,187 @@
+package pdfmeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func deflate(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestParseReferenceCycles(t *testing.T) {
+	tests := []struct {
+		name string
+		pdf  string
+	}{
+		{
+			"self",
+			"%PDF-1.4\n1 0 obj << /Title (Self) /Length 1 0 R >> stream\nxx\nendstream endobj\n" +
+				"trailer << /Info 1 0 R >>\n",
+		},
+		{
+			"unterminated",
+			"%PDF-1.4\n1 0 obj << /Title (x) /Length 1 0 R >> stream",
+		},
+		{
+			"mutual",
+			"%PDF-1.4\n1 0 obj << /Title (Mutual) /Length 2 0 R >> stream\nxx\nendstream endobj\n" +
+				"2 0 obj << /Length 1 0 R >> stream\nxx\nendstream endobj\n" +
+				"trailer << /Info 1 0 R >>\n",
+		},
+		{
+			"missing",
+			"%PDF-1.4\n1 0 obj << /Title (Missing) /Length 9 0 R >> stream\nxx\nendstream endobj\n" +
+				"trailer << /Info 1 0 R >>\n",
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := Parse([]byte(test.pdf)); err != nil {
+			t.Errorf("%s: Parse: %v", test.name, err)
+		}
+	}
+}
+
+func TestParseObjectStream(t *testing.T) {
+	objects := "5 0 << /Title (Compressed) /Author (A. Author) /CreationDate (D:19780101) >>"
+	header := "5 0 "
+	data := deflate(t, header+objects[len(header):])
+	pdf := fmt.Sprintf("%%PDF-1.5\n1 0 obj << /Type /ObjStm /N 1 /First %d /Filter /FlateDecode /Length %d >> stream\n%s\nendstream endobj\n"+
+		"trailer << /Info 5 0 R >>\n", len(header), len(data), data)
+
+	meta, err := Parse([]byte(pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "Compressed" || meta.Year != 1978 || len(meta.Authors) != 1 {
+		t.Errorf("Parse = %+v, want the Info dictionary from the object stream", meta)
+	}
+}
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreateDate="2014-05-20T10:00:00Z">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">In Search of an Understandable Consensus Algorithm</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>Diego Ongaro</rdf:li><rdf:li>John Ousterhout</rdf:li></rdf:Seq></dc:creator>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>`
+
+func TestParseXMP(t *testing.T) {
+	x := parseXMP([]byte(testXMP))
+	if x.title != "In Search of an Understandable Consensus Algorithm" {
+		t.Errorf("title = %q", x.title)
+	}
+	if len(x.creators) != 2 || x.creators[0] != "Diego Ongaro" || x.creators[1] != "John Ousterhout" {
+		t.Errorf("creators = %q", x.creators)
+	}
+	if x.date != "2014-05-20T10:00:00Z" {
+		t.Errorf("date = %q", x.date)
+	}
+
+	x = parseXMP([]byte(`<x:xmpmeta><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+		`<rdf:Description><dc:date><rdf:Seq><rdf:li>1978-07-01</rdf:li></rdf:Seq></dc:date><dc:title><rdf:Alt><rdf:li>Truncated`))
+	if x.date != "1978-07-01" || x.title != "" {
+		t.Errorf("malformed packet: got %+v, want the date read before the error", x)
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	info := "1 0 obj << /Title (Raft) /Author (D. Ongaro and J. Ousterhout) /CreationDate (D:20160101) >> endobj\n"
+	tests := []struct {
+		name string
+		pdf  string
+		want Metadata
+	}{
+		{
+			"info only",
+			"%PDF-1.4\n" + info + "trailer << /Info 1 0 R >>\n",
+			Metadata{
+				Title: "Raft", TitleSource: SourceInfo,
+				Authors: []string{"D. Ongaro", "J. Ousterhout"}, AuthorsSource: SourceInfo,
+				Year: 2016, YearSource: SourceInfo,
+			},
+		},
+		{
+			"xmp wins",
+			fmt.Sprintf("%%PDF-1.4\n%s2 0 obj << /Type /Catalog /Metadata 3 0 R >> endobj\n"+
+				"3 0 obj << /Type /Metadata /Subtype /XML /Length %d >> stream\n%s\nendstream endobj\n"+
+				"trailer << /Info 1 0 R /Root 2 0 R >>\n", info, len(testXMP), testXMP),
+			Metadata{
+				Title: "In Search of an Understandable Consensus Algorithm", TitleSource: SourceXMP,
+				Authors: []string{"Diego Ongaro", "John Ousterhout"}, AuthorsSource: SourceXMP,
+				Year: 2014, YearSource: SourceXMP,
+			},
+		},
+		{
+			"info fills gaps",
+			"%PDF-1.4\n" + info + "<x:xmpmeta><rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\">" +
+				"<rdf:Description><dc:title><rdf:Alt><rdf:li>Untitled</rdf:li></rdf:Alt></dc:title>" +
+				"<dc:creator><rdf:Seq><rdf:li>Diego Ongaro</rdf:li></rdf:Seq></dc:creator></rdf:Description></rdf:RDF></x:xmpmeta>\n" +
+				"trailer << /Info 1 0 R >>\n",
+			Metadata{
+				Title: "Raft", TitleSource: SourceInfo,
+				Authors: []string{"Diego Ongaro"}, AuthorsSource: SourceXMP,
+				Year: 2016, YearSource: SourceInfo,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		meta, err := Parse([]byte(test.pdf))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*meta, test.want) {
+			t.Errorf("%s: Parse = %+v, want %+v", test.name, *meta, test.want)
+		}
+	}
+}
+
+func TestParseManyObjects(t *testing.T) {
+	const n = 4000
+
+	var pdf strings.Builder
+	pdf.WriteString("%PDF-1.5\n")
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&pdf, "%d 0 obj << /Length %d 0 R >> stream\nxx\nendstream endobj\n", 2*i, 2*i+1)
+		fmt.Fprintf(&pdf, "%d 0 obj 2 endobj\n", 2*i+1)
+	}
+	fmt.Fprintf(&pdf, "%d 0 obj << /Title (Last) >> endobj\ntrailer << /Info %d 0 R /Root %d 0 R >>\n", 2*n+2, 2*n+2, 2*n+3)
+
+	start := time.Now()
+	meta, err := Parse([]byte(pdf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "Last" {
+		t.Errorf("Title = %q, want %q", meta.Title, "Last")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("parsing %d objects took %s", 2*n, elapsed)
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	h := dict{"Filter": name("FlateDecode")}
+	data := deflate(t, string(make([]byte, maxDecoded+1)))
+	if _, err := decode(h, data); err != errTooLarge {
+		t.Errorf("decode = %v, want %v", err, errTooLarge)
+	}
+}
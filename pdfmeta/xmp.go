@@ -0,0 +1,92 @@
+package pdfmeta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// XML namespaces used by the XMP properties that are read.
+const (
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsXMP = "http://ns.adobe.com/xap/1.0/"
+	nsRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+// xmp holds the raw values read from an XMP packet.
+type xmp struct {
+	title    string
+	creators []string
+	date     string
+}
+
+// parseXMP reads the title, creators and creation date from an XMP packet.
+// A malformed packet yields whatever was read before the error.
+func parseXMP(packet []byte) xmp {
+	var x xmp
+	var stack []xml.Name
+	var text bytes.Buffer
+
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			text.Reset()
+			for _, attr := range t.Attr {
+				if attr.Name.Space == nsXMP && attr.Name.Local == "CreateDate" && x.date == "" {
+					x.date = attr.Value
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+			if len(stack) == 0 {
+				break
+			}
+			stack = stack[:len(stack)-1]
+
+			switch {
+			case t.Name.Space == nsRDF && t.Name.Local == "li" && within(stack, nsDC, "title"):
+				if x.title == "" {
+					x.title = value
+				}
+			case t.Name.Space == nsRDF && t.Name.Local == "li" && within(stack, nsDC, "creator"):
+				if value != "" {
+					x.creators = append(x.creators, value)
+				}
+			case t.Name.Space == nsXMP && t.Name.Local == "CreateDate":
+				if x.date == "" {
+					x.date = value
+				}
+			case t.Name.Space == nsDC && t.Name.Local == "date" && x.date == "":
+				x.date = value
+			case t.Name.Space == nsRDF && t.Name.Local == "li" && within(stack, nsDC, "date"):
+				if x.date == "" {
+					x.date = value
+				}
+			}
+		}
+	}
+
+	return x
+}
+
+// within returns true if an element named space:local is on the stack.
+func within(stack []xml.Name, space, local string) bool {
+	for _, n := range stack {
+		if n.Space == space && n.Local == local {
+			return true
+		}
+	}
+
+	return false
+}
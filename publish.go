@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Post is a paper formatted for publishing.
+type Post struct {
+	Text  string
+	Paper *Paper
+
+	// IdempotencyKey is the same every time the same post is published,
+	// so services that support it can drop retried duplicates.
+	IdempotencyKey string
+}
+
+// NewPost formats paper as a post: its name and kind, its links and its
+// hashtags, one per line.
+func NewPost(paper *Paper) Post {
+	name := fmt.Sprintf("%s (%s)", paper.Name, paper.Kind)
+	hashtags := "#" + strings.Join(paper.Hashtags(), " #")
+	lines := []string{name, paper.URL}
+	if paper.Mirror != "" {
+		lines = append(lines, "Mirror: "+paper.Mirror)
+	}
+	text := strings.Join(append(lines, hashtags), "\n")
+
+	sum := sha256.Sum256([]byte(paper.Permalink + "\n" + text))
+
+	return Post{
+		Text:           text,
+		Paper:          paper,
+		IdempotencyKey: hex.EncodeToString(sum[:16]),
+	}
+}
+
+// PaperByline returns the paper's authors and year, as far as they are
+// known, e.g. "Leslie Lamport, 2001".
+func PaperByline(paper *Paper) string {
+	parts := append([]string(nil), paper.Authors...)
+	if paper.Year != 0 {
+		parts = append(parts, strconv.Itoa(paper.Year))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Published identifies a published post.
+type Published struct {
+	ID  string
+	URL string
+}
+
+// Publisher publishes posts to a social network or chat.
+type Publisher interface {
+	// Name is the lower case name of the service, used in logs and the
+	// history.
+	Name() string
+
+	Publish(ctx context.Context, post Post) (*Published, error)
+}
+
+// NewPublishers returns a Publisher for each service named in the
+// configuration.
+func NewPublishers(config *Config) ([]Publisher, error) {
+	var publishers []Publisher
+	for _, name := range config.Publishers {
+		switch strings.ToLower(name) {
+		case "twitter":
+			auth, err := NewTwitterAuth(config)
+			if err != nil {
+				return nil, err
+			}
+			publishers = append(publishers, &TwitterPublisher{Client: NewTwitterClient(config.TwitterAPIURL, auth)})
+		case "mastodon":
+			if config.MastodonURL == "" {
+				return nil, fmt.Errorf("mastodon publisher needs MASTODON_URL")
+			}
+			token, err := SecretValue(config.MastodonToken, config.MastodonTokenFile)
+			if err != nil {
+				return nil, err
+			}
+			publishers = append(publishers, NewMastodonPublisher(config.MastodonURL, token, config.MastodonVisibility, config.MastodonLanguage))
+		case "bluesky":
+			if config.BlueskyIdentifier == "" {
+				return nil, fmt.Errorf("bluesky publisher needs BLUESKY_IDENTIFIER")
+			}
+			password, err := SecretValue(config.BlueskyPassword, config.BlueskyPasswordFile)
+			if err != nil {
+				return nil, err
+			}
+			publishers = append(publishers, NewBlueskyPublisher(config.BlueskyPDSURL, config.BlueskyIdentifier, password, config.BlueskyLanguage))
+		default:
+			kind, _, ok := ParseWebhook(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown publisher %q", name)
+			}
+			webhook := config.Webhooks[strings.ToLower(name)]
+			webhookURL, err := SecretValue(webhook.URL, webhook.URLFile)
+			if err != nil {
+				return nil, err
+			}
+			if webhookURL == "" {
+				return nil, fmt.Errorf("%s publisher needs %s_WEBHOOK_URL", name, WebhookEnv(name))
+			}
+			publishers = append(publishers, NewWebhookPublisher(name, kind, webhookURL))
+		}
+	}
+	if len(publishers) == 0 {
+		return nil, fmt.Errorf("no publishers configured")
+	}
+
+	return publishers, nil
+}
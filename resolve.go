@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// BlobStyle selects how links to files in a Github repository are posted.
+type BlobStyle string
+
+const (
+	// BlobViewer links to the file's page on github.com.
+	BlobViewer BlobStyle = "viewer"
+
+	// BlobRaw links to the file's raw content on raw.githubusercontent.com.
+	BlobRaw BlobStyle = "raw"
+)
+
+// ParseBlobStyle returns the BlobStyle named by s.
+func ParseBlobStyle(s string) (BlobStyle, error) {
+	switch style := BlobStyle(strings.ToLower(strings.TrimSpace(s))); style {
+	case BlobViewer, BlobRaw:
+		return style, nil
+	}
+
+	return "", fmt.Errorf("unknown blob style %q, want %q or %q", s, BlobViewer, BlobRaw)
+}
+
+// arxivPath matches the abs and pdf pages of an arXiv paper, capturing the
+// paper identifier without its version.
+var arxivPath = regexp.MustCompile(`^/(?:abs|pdf)/(.+?)(?:v\d+)?(?:\.pdf)?/?$`)
+
+// Resolver turns the links found in a README into canonical absolute URLs.
+type Resolver struct {
+	Style BlobStyle
+}
+
+// NewResolver returns a Resolver posting repository files in style.
+func NewResolver(style BlobStyle) *Resolver {
+	return &Resolver{Style: style}
+}
+
+// DefaultResolver links to repository files on github.com.
+var DefaultResolver = NewResolver(BlobViewer)
+
+// Resolve returns the canonical form of location as linked from the README
+// whose page on github.com is readme. Relative links are resolved against
+// the README, links starting with "/" against the repository root. Github
+// file links are rewritten to the resolver's style, arXiv links to the PDF
+// of the latest version and DOIs to https://doi.org. readme may be nil if
+// location is known to be absolute.
+func (r *Resolver) Resolve(readme *url.URL, location string) (string, error) {
+	location = strings.TrimSpace(location)
+	if strings.HasPrefix(strings.ToLower(location), "doi:") {
+		return "https://doi.org/" + strings.TrimSpace(location[len("doi:"):]), nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	if !u.IsAbs() {
+		if readme == nil {
+			return "", fmt.Errorf("can not resolve relative link %s", location)
+		}
+		u, err = resolveRelative(readme, u)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	switch host := strings.ToLower(u.Hostname()); {
+	case host == "github.com" || host == "raw.githubusercontent.com":
+		r.rewriteGithub(u)
+	case host == "arxiv.org" || strings.HasSuffix(host, ".arxiv.org"):
+		if m := arxivPath.FindStringSubmatch(u.Path); m != nil {
+			return "https://arxiv.org/pdf/" + m[1], nil
+		}
+	case host == "doi.org" || host == "dx.doi.org" || host == "www.doi.org":
+		u.Scheme = "https"
+		u.Host = "doi.org"
+	}
+
+	return u.String(), nil
+}
+
+// resolveRelative resolves the relative link u against readme. As on
+// Github, paths starting with "/" are relative to the root of the
+// repository readme is in, and "../" never leads out of the repository.
+func resolveRelative(readme, u *url.URL) (*url.URL, error) {
+	root, err := GithubRepoRoot(readme)
+	if err != nil {
+		if strings.HasPrefix(u.Path, "/") && u.Host == "" {
+			return nil, err
+		}
+		return readme.ResolveReference(u), nil
+	}
+	if u.Host != "" || u.Path == "" {
+		return readme.ResolveReference(u), nil
+	}
+
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Dir(strings.TrimPrefix(readme.Path, root.Path)) + "/" + p
+	}
+	ref := *u
+	ref.Path = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if strings.HasSuffix(u.Path, "/") && ref.Path != "" {
+		ref.Path += "/"
+	}
+	ref.RawPath = ""
+
+	return root.ResolveReference(&ref), nil
+}
+
+// rewriteGithub rewrites a link to a file in a Github repository to the
+// resolver's style. Links to anything but a file are left alone.
+func (r *Resolver) rewriteGithub(u *url.URL) {
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 5)
+
+	var owner, repo, ref, file string
+	switch {
+	case u.Host == "github.com" && len(parts) == 5 && (parts[2] == "blob" || parts[2] == "raw"):
+		owner, repo, ref, file = parts[0], parts[1], parts[3], parts[4]
+	case u.Host == "raw.githubusercontent.com" && len(parts) >= 4:
+		parts = strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 4)
+		owner, repo, ref, file = parts[0], parts[1], parts[2], parts[3]
+	default:
+		return
+	}
+
+	u.Scheme = "https"
+	u.RawPath = ""
+	if r.Style == BlobRaw {
+		u.Host = "raw.githubusercontent.com"
+		u.Path = strings.Join([]string{"", owner, repo, ref, file}, "/")
+		return
+	}
+	u.Host = "github.com"
+	u.Path = strings.Join([]string{"", owner, repo, "blob", ref, file}, "/")
+}
+
+// GithubRepoRoot returns the root directory URL of the repository the
+// github.com file page u belongs to.
+func GithubRepoRoot(u *url.URL) (*url.URL, error) {
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 5)
+	if len(parts) < 4 || parts[2] != "blob" {
+		return nil, fmt.Errorf("%s is not a Github file page", u)
+	}
+
+	root := *u
+	root.Path = strings.Join([]string{"", parts[0], parts[1], "blob", parts[3], ""}, "/")
+	root.RawQuery = ""
+	root.Fragment = ""
+
+	return &root, nil
+}
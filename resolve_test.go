@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	readme, err := url.Parse("https://github.com/papers-we-love/papers-we-love/blob/master/distributed_systems/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		blob = "https://github.com/papers-we-love/papers-we-love/blob/master/"
+		raw  = "https://raw.githubusercontent.com/papers-we-love/papers-we-love/master/"
+	)
+
+	tests := []struct {
+		location string
+		viewer   string
+		raw      string
+	}{
+		{"paxos.pdf", blob + "distributed_systems/paxos.pdf", raw + "distributed_systems/paxos.pdf"},
+		{"./paxos.pdf", blob + "distributed_systems/paxos.pdf", raw + "distributed_systems/paxos.pdf"},
+		{"../datastores/dynamo.pdf", blob + "datastores/dynamo.pdf", raw + "datastores/dynamo.pdf"},
+		{"../../../dynamo.pdf", blob + "dynamo.pdf", raw + "dynamo.pdf"},
+		{"notes/../paxos.pdf", blob + "distributed_systems/paxos.pdf", raw + "distributed_systems/paxos.pdf"},
+		{"/datastores/dynamo.pdf", blob + "datastores/dynamo.pdf", raw + "datastores/dynamo.pdf"},
+		{"/datastores/", blob + "datastores/", raw + "datastores/"},
+		{"a%20b.pdf", blob + "distributed_systems/a%20b.pdf", raw + "distributed_systems/a%20b.pdf"},
+		{"paxos.pdf?raw=true#page=2", blob + "distributed_systems/paxos.pdf?raw=true#page=2", raw + "distributed_systems/paxos.pdf?raw=true#page=2"},
+		{"#paxos", blob + "distributed_systems/README.md#paxos", raw + "distributed_systems/README.md#paxos"},
+		{"//example.org/paxos.pdf", "https://example.org/paxos.pdf", "https://example.org/paxos.pdf"},
+		{"https://example.org/paxos.pdf?download=1#page=3", "https://example.org/paxos.pdf?download=1#page=3", "https://example.org/paxos.pdf?download=1#page=3"},
+		{"https://arxiv.org/abs/1234.5678", "https://arxiv.org/pdf/1234.5678", "https://arxiv.org/pdf/1234.5678"},
+		{"https://arxiv.org/abs/1234.5678v3", "https://arxiv.org/pdf/1234.5678", "https://arxiv.org/pdf/1234.5678"},
+		{"https://arxiv.org/abs/1234.5678v3?context=cs#refs", "https://arxiv.org/pdf/1234.5678", "https://arxiv.org/pdf/1234.5678"},
+		{"http://export.arxiv.org/pdf/cs/0112017v1.pdf", "https://arxiv.org/pdf/cs/0112017", "https://arxiv.org/pdf/cs/0112017"},
+		{"https://arxiv.org/list/cs.DC/recent", "https://arxiv.org/list/cs.DC/recent", "https://arxiv.org/list/cs.DC/recent"},
+		{"doi:10.1145/359545.359563", "https://doi.org/10.1145/359545.359563", "https://doi.org/10.1145/359545.359563"},
+		{" DOI: 10.1145/359545.359563", "https://doi.org/10.1145/359545.359563", "https://doi.org/10.1145/359545.359563"},
+		{"http://dx.doi.org/10.1145/359545.359563", "https://doi.org/10.1145/359545.359563", "https://doi.org/10.1145/359545.359563"},
+		{"https://github.com/o/r/blob/main/dir/x.pdf", "https://github.com/o/r/blob/main/dir/x.pdf", "https://raw.githubusercontent.com/o/r/main/dir/x.pdf"},
+		{"https://github.com/o/r/raw/main/dir/x.pdf", "https://github.com/o/r/blob/main/dir/x.pdf", "https://raw.githubusercontent.com/o/r/main/dir/x.pdf"},
+		{"http://raw.githubusercontent.com/o/r/main/dir/x.pdf", "https://github.com/o/r/blob/main/dir/x.pdf", "https://raw.githubusercontent.com/o/r/main/dir/x.pdf"},
+		{"https://github.com/o/r/tree/main/dir", "https://github.com/o/r/tree/main/dir", "https://github.com/o/r/tree/main/dir"},
+	}
+
+	viewer, rawResolver := NewResolver(BlobViewer), NewResolver(BlobRaw)
+	for _, test := range tests {
+		if got, err := viewer.Resolve(readme, test.location); err != nil || got != test.viewer {
+			t.Errorf("viewer Resolve(%q) = %q, %v, want %q", test.location, got, err, test.viewer)
+		}
+		if got, err := rawResolver.Resolve(readme, test.location); err != nil || got != test.raw {
+			t.Errorf("raw Resolve(%q) = %q, %v, want %q", test.location, got, err, test.raw)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	other, err := url.Parse("https://example.org/papers/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := DefaultResolver.Resolve(nil, "paxos.pdf"); err == nil {
+		t.Errorf("Resolve() of a relative link without a README = %q, want an error", got)
+	}
+	if got, err := DefaultResolver.Resolve(other, "/paxos.pdf"); err == nil {
+		t.Errorf("Resolve() of a root link outside Github = %q, want an error", got)
+	}
+	if got, err := DefaultResolver.Resolve(other, "../paxos.pdf"); err != nil || got != "https://example.org/paxos.pdf" {
+		t.Errorf("Resolve() of a relative link outside Github = %q, %v, want https://example.org/paxos.pdf", got, err)
+	}
+}
+
+func TestGithubRepoRoot(t *testing.T) {
+	tests := []struct {
+		page string
+		root string
+	}{
+		{"https://github.com/o/r/blob/main/dir/README.md?plain=1#L3", "https://github.com/o/r/blob/main/"},
+		{"https://github.com/o/r/blob/main/README.md", "https://github.com/o/r/blob/main/"},
+		{"https://github.com/o/r/tree/main/dir", ""},
+		{"https://github.com/o/r", ""},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := GithubRepoRoot(u)
+		if test.root == "" {
+			if err == nil {
+				t.Errorf("GithubRepoRoot(%s) = %s, want an error", test.page, root)
+			}
+			continue
+		}
+		if err != nil || root.String() != test.root {
+			t.Errorf("GithubRepoRoot(%s) = %v, %v, want %s", test.page, root, err, test.root)
+		}
+	}
+}
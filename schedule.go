@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+	mrand "math/rand"
+	"time"
+)
+
+// RateLimitMargin is added to a rate limit reset time before retrying, to
+// allow for clock skew between the bot and Github.
+const RateLimitMargin = time.Minute
+
+// SleepTime returns how long to sleep after a search that ended with err. A
+// search that hit the rate limit is retried as soon as the limit resets,
+// anything else sleeps for a random 24 to 48 hours.
+func SleepTime(err error) time.Duration {
+	if reset, ok := RateLimitReset(err); ok {
+		wait := time.Until(reset) + RateLimitMargin
+		if wait < RateLimitMargin {
+			wait = RateLimitMargin
+		}
+		log.Printf("INFO: rate limited, retrying at %s ...", time.Now().Add(wait).Format(time.RFC3339))
+		return wait
+	}
+
+	mrand.Seed(time.Now().Unix())
+	// Random integer between 24 and 48. Int(n) returns a random Int from 0
+	// to n exclusive.
+	sleepTime := mrand.Intn(25) + 24
+	log.Printf("INFO: sleeping for %d hours ...", sleepTime)
+
+	return time.Duration(sleepTime) * time.Hour
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// DeadEndAfter is the number of consecutive times a README may yield no
+// papers before it is treated as a dead end and no longer read.
+const DeadEndAfter = 2
+
+// SearchBudget limits the work done while looking for a paper.
+type SearchBudget struct {
+	// Attempts is the number of candidate papers FindPaper tries before
+	// giving up.
+	Attempts int
+
+	// APICalls is the number of Github API requests a single catalog build
+	// may make. READMEs read from a local checkout or a tarball are not
+	// counted.
+	APICalls int
+}
+
+// SearchErrorReason describes why a search found no paper.
+type SearchErrorReason int
+
+const (
+	// RateLimited means the Github API rate limit was hit.
+	RateLimited SearchErrorReason = iota
+
+	// BudgetExhausted means the attempt or API call budget ran out.
+	BudgetExhausted
+
+	// NoCandidates means there was nothing left to try.
+	NoCandidates
+)
+
+func (r SearchErrorReason) String() string {
+	switch r {
+	case RateLimited:
+		return "rate limited"
+	case BudgetExhausted:
+		return "budget exhausted"
+	case NoCandidates:
+		return "no candidates"
+	}
+
+	return fmt.Sprintf("SearchErrorReason(%d)", int(r))
+}
+
+// SearchError is returned when no paper could be found. Err holds the
+// underlying error, if any. Reset is set for RateLimited errors when the
+// time the rate limit resets is known.
+type SearchError struct {
+	Reason SearchErrorReason
+	Reset  time.Time
+	Err    error
+}
+
+func (e *SearchError) Error() string {
+	if !e.Reset.IsZero() {
+		return fmt.Sprintf("no paper found: %s until %s", e.Reason, e.Reset)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("no paper found: %s: %s", e.Reason, e.Err)
+	}
+
+	return fmt.Sprintf("no paper found: %s", e.Reason)
+}
+
+// Unwrap returns the underlying error.
+func (e *SearchError) Unwrap() error {
+	return e.Err
+}
+
+// IsRateLimit returns true if err was caused by hitting the Github API rate
+// limit.
+func IsRateLimit(err error) bool {
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		return true
+	case *SearchError:
+		return e.Reason == RateLimited
+	}
+
+	return false
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// PaperSource gives access to the README files of a papers repository.
+// Paths are slash separated and relative to the repository root.
+type PaperSource interface {
+	// Readmes returns the path of every README.md in the repository.
+	Readmes() ([]string, error)
+
+	// ReadReadme returns the content of the README at path.
+	ReadReadme(path string) ([]byte, error)
+}
+
+// RateLimitedSource is implemented by sources that spend Github API
+// requests. Rate returns the current core API rate limit.
+type RateLimitedSource interface {
+	Rate() (*github.Rate, error)
+}
+
+// NewPaperSource returns the PaperSource selected by the configuration.
+func NewPaperSource(config *Config, client *github.Client) (PaperSource, error) {
+	switch config.Source {
+	case "github":
+		return NewGithubSource(client, config.Owner, config.Repo, config.IndexRef), nil
+	case "local":
+		return NewLocalSource(config.SourceDir), nil
+	case "tarball":
+		return NewTarballSource(client, config.Owner, config.Repo, config.IndexRef), nil
+	}
+
+	return nil, fmt.Errorf("unknown paper source %q", config.Source)
+}
+
+// GithubSource reads READMEs through the Github API. The repository tree is
+// listed with a single recursive Git Trees API call and each README is then
+// fetched as a blob.
+type GithubSource struct {
+	Owner string
+	Repo  string
+	Ref   string
+
+	client *github.Client
+
+	mu   sync.Mutex
+	shas map[string]string
+}
+
+// NewGithubSource returns a GithubSource for owner/repo at ref.
+func NewGithubSource(client *github.Client, owner, repo, ref string) *GithubSource {
+	return &GithubSource{
+		Owner:  owner,
+		Repo:   repo,
+		Ref:    ref,
+		client: client,
+		shas:   make(map[string]string),
+	}
+}
+
+// Readmes lists the repository tree and returns every README.md path.
+func (s *GithubSource) Readmes() ([]string, error) {
+	tree, resp, err := s.client.Git.GetTree(s.Owner, s.Repo, s.Ref, true)
+	LogRate(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var readmes []string
+	for _, entry := range tree.Entries {
+		if entry.Type == nil || *entry.Type != "blob" || entry.Path == nil || entry.SHA == nil {
+			continue
+		}
+		if path.Base(*entry.Path) != "README.md" {
+			continue
+		}
+		s.shas[*entry.Path] = *entry.SHA
+		readmes = append(readmes, *entry.Path)
+	}
+
+	return readmes, nil
+}
+
+// ReadReadme fetches the README at p. READMEs seen by Readmes are fetched by
+// blob SHA, anything else goes through the contents API.
+func (s *GithubSource) ReadReadme(p string) ([]byte, error) {
+	s.mu.Lock()
+	sha, ok := s.shas[p]
+	s.mu.Unlock()
+
+	if !ok {
+		fc, _, resp, err := s.client.Repositories.GetContents(s.Owner, s.Repo, p, &github.RepositoryContentGetOptions{Ref: s.Ref})
+		LogRate(resp)
+		if err != nil {
+			return nil, err
+		}
+		if fc == nil {
+			return nil, fmt.Errorf("%s is a directory", p)
+		}
+		content, err := fc.GetContent()
+		return []byte(content), err
+	}
+
+	blob, resp, err := s.client.Git.GetBlob(s.Owner, s.Repo, sha)
+	LogRate(resp)
+	if err != nil {
+		return nil, err
+	}
+	if blob.Content == nil {
+		return nil, fmt.Errorf("empty blob %s", sha)
+	}
+
+	return base64.StdEncoding.DecodeString(*blob.Content)
+}
+
+// Rate returns the client's current core API rate limit.
+func (s *GithubSource) Rate() (*github.Rate, error) {
+	return CoreRate(s.client)
+}
+
+// LocalSource reads READMEs from a checkout of the repository on disk.
+type LocalSource struct {
+	Dir string
+}
+
+// NewLocalSource returns a LocalSource rooted at dir.
+func NewLocalSource(dir string) *LocalSource {
+	return &LocalSource{Dir: dir}
+}
+
+// Readmes walks the checkout and returns every README.md path. The .git
+// directory is not descended into.
+func (s *LocalSource) Readmes() ([]string, error) {
+	var readmes []string
+	err := filepath.Walk(s.Dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() != "README.md" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		readmes = append(readmes, filepath.ToSlash(rel))
+
+		return nil
+	})
+
+	return readmes, err
+}
+
+// ReadReadme reads the README at p from disk.
+func (s *LocalSource) ReadReadme(p string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(p)))
+}
+
+const (
+	// TarballTimeout is how long a TarballSource waits for a tarball to
+	// download.
+	TarballTimeout = 5 * time.Minute
+
+	// TarballMaxSize is the largest tarball, in bytes, a TarballSource
+	// downloads.
+	TarballMaxSize = 512 << 20
+)
+
+// TarballSource reads READMEs from a gzipped tarball of the repository. The
+// tarball is downloaded once per call to Readmes and the READMEs found in it
+// are kept in memory.
+type TarballSource struct {
+	Owner string
+	Repo  string
+	Ref   string
+
+	// MaxSize is the largest tarball, in bytes, that is downloaded.
+	MaxSize int64
+
+	client     *github.Client
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	readmes map[string][]byte
+}
+
+// NewTarballSource returns a TarballSource for owner/repo at ref.
+func NewTarballSource(client *github.Client, owner, repo, ref string) *TarballSource {
+	return &TarballSource{
+		Owner:      owner,
+		Repo:       repo,
+		Ref:        ref,
+		MaxSize:    TarballMaxSize,
+		client:     client,
+		httpClient: &http.Client{Timeout: TarballTimeout},
+	}
+}
+
+// Readmes downloads the repository tarball and returns every README.md path
+// found in it.
+func (s *TarballSource) Readmes() ([]string, error) {
+	link, resp, err := s.client.Repositories.GetArchiveLink(s.Owner, s.Repo, github.Tarball, &github.RepositoryContentGetOptions{Ref: s.Ref})
+	LogRate(resp)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, fmt.Errorf("no archive link for %s/%s@%s", s.Owner, s.Repo, s.Ref)
+	}
+
+	log.Printf("INFO: downloading %s", link)
+	tarball, err := s.httpClient.Get(link.String())
+	if err != nil {
+		return nil, err
+	}
+	defer tarball.Body.Close()
+
+	if tarball.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading tarball: %s", tarball.Status)
+	}
+	if tarball.ContentLength > s.MaxSize {
+		return nil, fmt.Errorf("tarball is larger than %d bytes", s.MaxSize)
+	}
+
+	body := &io.LimitedReader{R: tarball.Body, N: s.MaxSize + 1}
+	readmes, err := ReadTarballReadmes(body)
+	if body.N == 0 {
+		return nil, fmt.Errorf("tarball is larger than %d bytes", s.MaxSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.readmes = readmes
+	s.mu.Unlock()
+
+	var paths []string
+	for p := range readmes {
+		paths = append(paths, p)
+	}
+
+	return paths, nil
+}
+
+// Rate returns the client's current core API rate limit.
+func (s *TarballSource) Rate() (*github.Rate, error) {
+	return CoreRate(s.client)
+}
+
+// ReadReadme returns the README at p from the last downloaded tarball.
+func (s *TarballSource) ReadReadme(p string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.readmes[p]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in tarball", p)
+	}
+
+	return content, nil
+}
+
+// ReadTarballReadmes reads a gzipped Github repository tarball and returns
+// the content of every README.md in it keyed by path. Github prefixes every
+// entry with a single "owner-repo-sha" directory which is stripped.
+func ReadTarballReadmes(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	readmes := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := header.Name
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		if path.Base(name) != "README.md" {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		readmes[name] = content
+	}
+
+	return readmes, nil
+}
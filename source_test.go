@@ -0,0 +1,75 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testTarball returns a gzipped Github style tarball holding files.
+func testTarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		header := &tar.Header{Name: "papers-we-love-papers-we-love-sha/" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestTarballSource(t *testing.T) {
+	tarball := testTarball(t, map[string]string{
+		"consensus/README.md": budgetReadme("consensus"),
+		"consensus/paxos.pdf": strings.Repeat("%PDF", 1024),
+	})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/papers-we-love/papers-we-love/tarball/master":
+			w.Header().Set("Location", "http://"+r.Host+"/download.tar.gz")
+			w.WriteHeader(http.StatusFound)
+		case "/download.tar.gz":
+			w.Header().Set("Content-Type", "application/gzip")
+			// Streamed without a Content-Length, so only the read is
+			// limited.
+			w.(http.Flusher).Flush()
+			w.Write(tarball)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	client := newTestGithubClient(t, &Config{}, handler, nil)
+	source := NewTarballSource(client, "papers-we-love", "papers-we-love", "master")
+
+	readmes, err := source.Readmes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readmes) != 1 || readmes[0] != "consensus/README.md" {
+		t.Errorf("Readmes() = %q, want consensus/README.md", readmes)
+	}
+	content, err := source.ReadReadme("consensus/README.md")
+	if err != nil || string(content) != budgetReadme("consensus") {
+		t.Errorf("ReadReadme() = %q, %v, want the README", content, err)
+	}
+
+	source.MaxSize = int64(len(tarball)) - 1
+	if _, err := source.Readmes(); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Readmes() of a tarball over MaxSize = %v, want a size error", err)
+	}
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/kurrik/oauth1a"
+)
+
+const (
+	// DefaultTwitterAPI is the base URL of the Twitter API.
+	DefaultTwitterAPI = "https://api.twitter.com"
+
+	// TwitterMaxLength is the longest a tweet's text may be, in characters
+	// as Twitter counts them: every link counts as TwitterLinkLength
+	// characters, whatever its length.
+	TwitterMaxLength  = 280
+	TwitterLinkLength = 23
+
+	// TwitterAuthorizeURL is where users grant the bot OAuth 2.0 access.
+	TwitterAuthorizeURL = "https://twitter.com/i/oauth2/authorize"
+)
+
+// TwitterScopes are the OAuth 2.0 scopes the bot asks for. offline.access
+// is needed to be given refresh tokens.
+var TwitterScopes = []string{"tweet.read", "tweet.write", "users.read", "offline.access"}
+
+// Errors a TwitterError can be matched against with errors.Is.
+var (
+	ErrTwitterUnauthorized = errors.New("twitter: unauthorized")
+	ErrTwitterForbidden    = errors.New("twitter: forbidden")
+	ErrTwitterDuplicate    = errors.New("twitter: duplicate tweet")
+	ErrTwitterRateLimited  = errors.New("twitter: rate limited")
+	ErrTwitterUnavailable  = errors.New("twitter: service unavailable")
+
+	// ErrTwitterReauthorize is matched by token endpoint errors that only
+	// running the twitter-auth command again can fix.
+	ErrTwitterReauthorize = errors.New("twitter: run love-a-paper twitter-auth to authorize the bot again")
+)
+
+// TwitterError is an error response from the v2 API. Reset is when the
+// rate limit resets, if the response said.
+type TwitterError struct {
+	Status int
+	Title  string
+	Detail string
+	Type   string
+	Reset  time.Time
+}
+
+func (e *TwitterError) Error() string {
+	msg := e.Title
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Detail != "" && e.Detail != msg {
+		msg += ": " + e.Detail
+	}
+
+	return fmt.Sprintf("twitter: %d %s", e.Status, msg)
+}
+
+// Unwrap returns the Err* value describing the error, if any.
+func (e *TwitterError) Unwrap() error {
+	switch {
+	case e.Status == http.StatusUnauthorized:
+		return ErrTwitterUnauthorized
+	case e.Status == http.StatusForbidden && strings.Contains(strings.ToLower(e.Detail), "duplicate"):
+		return ErrTwitterDuplicate
+	case e.Status == http.StatusForbidden:
+		return ErrTwitterForbidden
+	case e.Status == http.StatusTooManyRequests:
+		return ErrTwitterRateLimited
+	case e.Status >= 500:
+		return ErrTwitterUnavailable
+	}
+
+	return nil
+}
+
+// parseTwitterError returns the error described by an unsuccessful API
+// response. Both the v2 problem format and the older list of errors are
+// understood.
+func parseTwitterError(resp *http.Response, body []byte) *TwitterError {
+	e := &TwitterError{Status: resp.StatusCode}
+
+	var problem struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+		Type   string `json:"type"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &problem) == nil {
+		e.Title, e.Detail, e.Type = problem.Title, problem.Detail, problem.Type
+		if e.Detail == "" && len(problem.Errors) > 0 {
+			e.Detail = problem.Errors[0].Message
+		}
+	}
+
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64); err == nil {
+		e.Reset = time.Unix(reset, 0)
+	}
+
+	return e
+}
+
+// TwitterAuth authorizes requests to the Twitter API.
+type TwitterAuth interface {
+	Authorize(ctx context.Context, req *http.Request) error
+}
+
+// TwitterOAuth1 signs requests with OAuth 1.0a user credentials. JSON
+// bodies are not part of the signature.
+type TwitterOAuth1 struct {
+	Client *oauth1a.ClientConfig
+	User   *oauth1a.UserConfig
+}
+
+// NewTwitterOAuth1 returns a TwitterOAuth1 for the app's consumer key and
+// secret and the user's access token and secret.
+func NewTwitterOAuth1(consumerKey, consumerSecret, token, tokenSecret string) *TwitterOAuth1 {
+	return &TwitterOAuth1{
+		Client: &oauth1a.ClientConfig{
+			ConsumerKey:    consumerKey,
+			ConsumerSecret: consumerSecret,
+		},
+		User: oauth1a.NewAuthorizedConfig(token, tokenSecret),
+	}
+}
+
+func (a *TwitterOAuth1) Authorize(ctx context.Context, req *http.Request) error {
+	return (&oauth1a.HmacSha1Signer{}).Sign(req, a.Client, a.User)
+}
+
+// TwitterToken is an OAuth 2.0 user token.
+type TwitterToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// expiring returns true if the token expires within a minute.
+func (t *TwitterToken) expiring() bool {
+	return !t.Expiry.IsZero() && time.Now().Add(time.Minute).After(t.Expiry)
+}
+
+// TwitterTokenStore keeps a TwitterToken in a file readable only by its
+// owner.
+type TwitterTokenStore struct {
+	Path string
+}
+
+// Load reads the stored token.
+func (s *TwitterTokenStore) Load() (*TwitterToken, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &TwitterToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("%s: %s", s.Path, err)
+	}
+
+	return token, nil
+}
+
+// Save replaces the stored token. The file is replaced atomically so a
+// crash can not lose the only valid refresh token.
+func (s *TwitterTokenStore) Save(token *TwitterToken) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.Path), ".twitter-token")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.Path)
+}
+
+// TwitterOAuthError is an error response from the OAuth 2.0 token endpoint.
+// A Code of "invalid_grant" means the refresh token was revoked or already
+// used and the bot must be authorized again.
+type TwitterOAuthError struct {
+	Status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *TwitterOAuthError) Error() string {
+	msg := fmt.Sprintf("twitter oauth: %d %s", e.Status, e.Code)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.Unwrap() != nil {
+		msg += ", run love-a-paper twitter-auth to authorize the bot again"
+	}
+
+	return msg
+}
+
+// Unwrap returns ErrTwitterReauthorize for an invalid grant.
+func (e *TwitterOAuthError) Unwrap() error {
+	if e.Code == "invalid_grant" {
+		return ErrTwitterReauthorize
+	}
+
+	return nil
+}
+
+// TwitterOAuth2 authorizes requests with an OAuth 2.0 user token obtained
+// with the PKCE authorization code flow. Twitter rotates refresh tokens, so
+// every refreshed token is saved to Store before it is used.
+type TwitterOAuth2 struct {
+	ClientID string
+
+	// ClientSecret is only set for confidential clients.
+	ClientSecret string
+	RedirectURL  string
+	BaseURL      string
+	Store        *TwitterTokenStore
+
+	client *http.Client
+
+	mu    sync.Mutex
+	token *TwitterToken
+}
+
+// NewTwitterOAuth2 returns a TwitterOAuth2 for the app's client, talking to
+// the API at baseURL and keeping its token in tokenFile.
+func NewTwitterOAuth2(clientID, clientSecret, redirectURL, baseURL, tokenFile string) *TwitterOAuth2 {
+	return &TwitterOAuth2{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		Store:        &TwitterTokenStore{Path: tokenFile},
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Authorize sets the bearer token, refreshing it first if it is about to
+// expire.
+func (a *TwitterOAuth2) Authorize(ctx context.Context, req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == nil {
+		token, err := a.Store.Load()
+		if err != nil {
+			return err
+		}
+		a.token = token
+	}
+	if a.token.expiring() {
+		if err := a.refresh(ctx); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token.AccessToken)
+
+	return nil
+}
+
+// Refresh exchanges the refresh token for a new token.
+func (a *TwitterOAuth2) Refresh(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == nil {
+		token, err := a.Store.Load()
+		if err != nil {
+			return err
+		}
+		a.token = token
+	}
+
+	return a.refresh(ctx)
+}
+
+func (a *TwitterOAuth2) refresh(ctx context.Context) error {
+	if a.token.RefreshToken == "" {
+		return fmt.Errorf("twitter oauth: no refresh token, authorize again")
+	}
+
+	token, err := a.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {a.token.RefreshToken},
+	})
+	if err != nil {
+		return err
+	}
+	a.token = token
+
+	return nil
+}
+
+// AuthCodeURL returns the URL the user authorizes the bot at. verifier is
+// the PKCE code verifier later passed to Exchange.
+func (a *TwitterOAuth2) AuthCodeURL(state, verifier string) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {a.ClientID},
+		"redirect_uri":          {a.RedirectURL},
+		"scope":                 {strings.Join(TwitterScopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	return TwitterAuthorizeURL + "?" + v.Encode()
+}
+
+// Exchange trades an authorization code for a token and saves it.
+func (a *TwitterOAuth2) Exchange(ctx context.Context, code, verifier string) (*TwitterToken, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	token, err := a.requestToken(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {a.RedirectURL},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.token = token
+
+	return token, nil
+}
+
+// requestToken requests a token from the token endpoint and saves it.
+func (a *TwitterOAuth2) requestToken(ctx context.Context, form url.Values) (*TwitterToken, error) {
+	form.Set("client_id", a.ClientID)
+
+	req, err := http.NewRequest("POST", a.BaseURL+"/2/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", UserAgent)
+	if a.ClientSecret != "" {
+		req.SetBasicAuth(a.ClientID, a.ClientSecret)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		oauthErr := &TwitterOAuthError{Status: resp.StatusCode}
+		if json.Unmarshal(body, oauthErr) != nil || oauthErr.Code == "" {
+			oauthErr.Code = http.StatusText(resp.StatusCode)
+		}
+		return nil, oauthErr
+	}
+
+	var granted struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &granted); err != nil {
+		return nil, err
+	}
+
+	// A refresh that does not rotate the refresh token leaves the old one
+	// valid.
+	token := &TwitterToken{
+		AccessToken:  granted.AccessToken,
+		RefreshToken: granted.RefreshToken,
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = form.Get("refresh_token")
+	}
+	if granted.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(granted.ExpiresIn) * time.Second)
+	}
+	if err := a.Store.Save(token); err != nil {
+		return nil, fmt.Errorf("saving twitter token: %s", err)
+	}
+
+	return token, nil
+}
+
+// NewPKCEVerifier returns a random PKCE code verifier.
+func NewPKCEVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PKCEChallenge returns the S256 code challenge for verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// TwitterAuthorize runs the PKCE flow interactively: it writes the
+// authorization URL to out and reads the URL the user was redirected to, or
+// just the code, from in.
+func TwitterAuthorize(ctx context.Context, auth *TwitterOAuth2, in io.Reader, out io.Writer) error {
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		return err
+	}
+	state, err := NewPKCEVerifier()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Authorize the bot at:\n\n%s\n\nthen paste the URL you were redirected to: ", auth.AuthCodeURL(state, verifier))
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return err
+	}
+	line = strings.TrimSpace(line)
+
+	code := line
+	if redirect, err := url.Parse(line); err == nil && redirect.RawQuery != "" {
+		query := redirect.Query()
+		if e := query.Get("error"); e != "" {
+			return fmt.Errorf("twitter oauth: %s", e)
+		}
+		if query.Get("state") != state {
+			return fmt.Errorf("twitter oauth: state does not match")
+		}
+		code = query.Get("code")
+	}
+	if code == "" {
+		return fmt.Errorf("twitter oauth: no authorization code")
+	}
+
+	if _, err := auth.Exchange(ctx, code, verifier); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Token saved to %s\n", auth.Store.Path)
+
+	return nil
+}
+
+// Tweet is a tweet created with the v2 API.
+type Tweet struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// TwitterClient posts tweets with the Twitter v2 API.
+type TwitterClient struct {
+	BaseURL string
+	Auth    TwitterAuth
+
+	client *http.Client
+}
+
+// NewTwitterClient returns a TwitterClient for the API at baseURL.
+func NewTwitterClient(baseURL string, auth TwitterAuth) *TwitterClient {
+	return &TwitterClient{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Auth:    auth,
+		client:  &http.Client{},
+	}
+}
+
+// CreateTweet tweets text. If the API rejects an OAuth 2.0 access token the
+// token is refreshed and the tweet sent once more.
+func (c *TwitterClient) CreateTweet(ctx context.Context, text string) (*Tweet, error) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return nil, err
+	}
+
+	tweet, err := c.createTweet(ctx, body)
+	if refresher, ok := c.Auth.(*TwitterOAuth2); ok && errors.Is(err, ErrTwitterUnauthorized) {
+		if err := refresher.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		tweet, err = c.createTweet(ctx, body)
+	}
+
+	return tweet, err
+}
+
+func (c *TwitterClient) createTweet(ctx context.Context, body []byte) (*Tweet, error) {
+	req, err := http.NewRequest("POST", c.BaseURL+"/2/tweets", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+	if err := c.Auth.Authorize(ctx, req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, parseTwitterError(resp, data)
+	}
+
+	var created struct {
+		Data Tweet `json:"data"`
+	}
+	if err := json.Unmarshal(data, &created); err != nil {
+		return nil, err
+	}
+
+	return &created.Data, nil
+}
+
+// NewTwitterAuth returns OAuth 2.0 authorization if a client ID is
+// configured and OAuth 1.0a signing with the configured user credentials
+// otherwise.
+func NewTwitterAuth(config *Config) (TwitterAuth, error) {
+	if config.TwitterClientID != "" {
+		secret, err := SecretValue(config.TwitterClientSecret, config.TwitterClientSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewTwitterOAuth2(config.TwitterClientID, secret, config.TwitterRedirectURL, config.TwitterAPIURL, config.TwitterTokenFile), nil
+	}
+
+	if config.TwitterConsumerKey == "" || config.TwitterAccessToken == "" {
+		return nil, fmt.Errorf("twitter publisher needs TWITTER_CLIENT_ID or OAuth 1.0a credentials")
+	}
+
+	return NewTwitterOAuth1(config.TwitterConsumerKey, config.TwitterConsumerSecret, config.TwitterAccessToken, config.TwitterAccessSecret), nil
+}
+
+// TweetLength returns the length of text as Twitter counts it.
+func TweetLength(text string) int {
+	n := Graphemes(text)
+	for _, m := range facetLink.FindAllStringIndex(text, -1) {
+		uri := strings.TrimRight(text[m[0]:m[1]], ".,;:!?)")
+		n += TwitterLinkLength - Graphemes(uri)
+	}
+
+	return n
+}
+
+// cutTweet returns text cut to at most n characters as Twitter counts
+// them, the last of them an ellipsis if it was cut. Links are never cut
+// through.
+func cutTweet(text string, n int) string {
+	if TweetLength(text) <= n {
+		return text
+	}
+
+	links := facetLink.FindAllStringIndex(text, -1)
+	cut := 0
+	for i := range text {
+		inLink := false
+		for _, m := range links {
+			if i > m[0] && i < m[1] {
+				inLink = true
+				break
+			}
+		}
+		if inLink {
+			continue
+		}
+		if TweetLength(text[:i])+1 > n {
+			break
+		}
+		cut = i
+	}
+
+	return strings.TrimRightFunc(text[:cut], unicode.IsSpace) + "…"
+}
+
+// TwitterText returns the text of post shortened to fit in
+// TwitterMaxLength. The paper's name of a post that is too long is cut
+// first, then its hashtags dropped. As a last resort the text is cut.
+func TwitterText(post Post) string {
+	if TweetLength(post.Text) <= TwitterMaxLength || post.Paper == nil {
+		return cutTweet(post.Text, TwitterMaxLength)
+	}
+
+	paper := post.Paper
+	var text string
+	for _, tags := range []bool{true, false} {
+		text = paperText(paper, Graphemes(paper.Name), false, tags).text.String()
+		over := TweetLength(text) - TwitterMaxLength
+		if over <= 0 {
+			return text
+		}
+		if name := Graphemes(paper.Name) - over; name >= TwitterLinkLength {
+			return paperText(paper, name, false, tags).text.String()
+		}
+	}
+
+	return cutTweet(text, TwitterMaxLength)
+}
+
+// TwitterPublisher tweets posts with the v2 API.
+type TwitterPublisher struct {
+	Client *TwitterClient
+}
+
+func (t *TwitterPublisher) Name() string {
+	return "twitter"
+}
+
+// Publish tweets the text of post, shortened to fit.
+func (t *TwitterPublisher) Publish(ctx context.Context, post Post) (*Published, error) {
+	tweet, err := t.Client.CreateTweet(ctx, TwitterText(post))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Published{
+		ID:  tweet.ID,
+		URL: "https://twitter.com/i/web/status/" + tweet.ID,
+	}, nil
+}
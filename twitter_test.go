@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTwitterCreateTweet(t *testing.T) {
+	const text = "Paxos Made Simple (PDF)\nhttps://lamport.azurewebsites.net/pubs/paxos-simple.pdf\n#distributed_systems"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/2/tweets" {
+			t.Errorf("got %s %s, want POST /2/tweets", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", got)
+		}
+		if got := r.Header.Get("Authorization"); !strings.HasPrefix(got, "OAuth ") || !strings.Contains(got, `oauth_token="token"`) {
+			t.Errorf("Authorization = %q, want an OAuth 1.0a signature for the user", got)
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatalf("body %s: %s", data, err)
+		}
+		if len(body) != 1 || body["text"] != text {
+			t.Errorf("body = %s, want only the text", data)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"data": {"id": "1445880548472328192", "text": "tweet"}}`)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	publisher := &TwitterPublisher{
+		Client: NewTwitterClient(server.URL+"/", NewTwitterOAuth1("key", "secret", "token", "token secret")),
+	}
+	published, err := publisher.Publish(context.Background(), Post{Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published.ID != "1445880548472328192" || published.URL != "https://twitter.com/i/web/status/1445880548472328192" {
+		t.Errorf("Publish() = %+v", published)
+	}
+}
+
+func TestTwitterCreateTweetError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusForbidden, `{"title": "Forbidden", "detail": "You are not allowed to create a Tweet with duplicate content."}`, ErrTwitterDuplicate},
+		{http.StatusForbidden, `{"errors": [{"message": "Your account is suspended"}]}`, ErrTwitterForbidden},
+		{http.StatusTooManyRequests, `{"title": "Too Many Requests"}`, ErrTwitterRateLimited},
+		{http.StatusServiceUnavailable, ``, ErrTwitterUnavailable},
+	}
+
+	for _, test := range tests {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Rate-Limit-Reset", "1700000000")
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		})
+		server := httptest.NewServer(handler)
+
+		client := NewTwitterClient(server.URL, NewTwitterOAuth1("key", "secret", "token", "token secret"))
+		_, err := client.CreateTweet(context.Background(), "text")
+		server.Close()
+
+		if !errors.Is(err, test.want) {
+			t.Errorf("%d %s: error = %v, want %v", test.status, test.body, err, test.want)
+			continue
+		}
+		var twitterErr *TwitterError
+		if errors.As(err, &twitterErr) && twitterErr.Reset.Unix() != 1700000000 {
+			t.Errorf("%d: Reset = %s, want the X-Rate-Limit-Reset time", test.status, twitterErr.Reset)
+		}
+	}
+}
+
+// twitterOAuth2Server is a fake Twitter API granting tokens and accepting
+// tweets authorized with the current access token.
+type twitterOAuth2Server struct {
+	t *testing.T
+
+	// grant is the response to token requests, access the token tweets
+	// are accepted with.
+	grant  string
+	status int
+	access string
+
+	refreshTokens []string
+	tweets        int
+}
+
+func (s *twitterOAuth2Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/2/oauth2/token":
+		if err := r.ParseForm(); err != nil {
+			s.t.Fatal(err)
+		}
+		if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("client_id") != "client" {
+			s.t.Errorf("token request form = %v, want a refresh for the client", r.PostForm)
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			s.t.Errorf("token request basic auth = %q, %q, %t, want the client credentials", id, secret, ok)
+		}
+		s.refreshTokens = append(s.refreshTokens, r.PostForm.Get("refresh_token"))
+		if s.status != 0 {
+			w.WriteHeader(s.status)
+		}
+		fmt.Fprint(w, s.grant)
+	case "/2/tweets":
+		s.tweets++
+		if r.Header.Get("Authorization") != "Bearer "+s.access {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"title": "Unauthorized", "status": 401}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"data": {"id": "1", "text": "tweet"}}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newTwitterOAuth2 returns a TwitterOAuth2 for the server whose token file
+// holds token.
+func newTwitterOAuth2(t *testing.T, server *httptest.Server, token *TwitterToken) *TwitterOAuth2 {
+	auth := NewTwitterOAuth2("client", "secret", "http://127.0.0.1/callback", server.URL, filepath.Join(t.TempDir(), "twitter-token.json"))
+	if err := auth.Store.Save(token); err != nil {
+		t.Fatal(err)
+	}
+
+	return auth
+}
+
+// readToken returns the token saved in the file at p.
+func readToken(t *testing.T, p string) *TwitterToken {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &TwitterToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		t.Fatalf("%s: %s", data, err)
+	}
+
+	return token
+}
+
+func TestTwitterOAuth2Refresh(t *testing.T) {
+	fake := &twitterOAuth2Server{
+		t:      t,
+		grant:  `{"token_type": "bearer", "access_token": "access2", "refresh_token": "refresh2", "expires_in": 7200}`,
+		access: "access2",
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	auth := newTwitterOAuth2(t, server, &TwitterToken{AccessToken: "access1", RefreshToken: "refresh1", Expiry: time.Now().Add(-time.Minute)})
+	if _, err := NewTwitterClient(server.URL, auth).CreateTweet(context.Background(), "text"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.refreshTokens) != 1 || fake.refreshTokens[0] != "refresh1" || fake.tweets != 1 {
+		t.Errorf("refreshed with %q and sent %d tweets, want one refresh with refresh1 and one tweet", fake.refreshTokens, fake.tweets)
+	}
+
+	saved := readToken(t, auth.Store.Path)
+	if saved.AccessToken != "access2" || saved.RefreshToken != "refresh2" {
+		t.Errorf("saved token %+v, want the rotated access2 and refresh2", saved)
+	}
+	if until := time.Until(saved.Expiry); until < time.Hour || until > 2*time.Hour {
+		t.Errorf("saved token expires in %s, want 2h", until)
+	}
+	info, err := os.Stat(auth.Store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %s, want -rw-------", info.Mode().Perm())
+	}
+
+	// A grant that does not rotate the refresh token keeps the old one.
+	fake.grant = `{"access_token": "access3", "expires_in": 7200}`
+	if err := auth.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if saved := readToken(t, auth.Store.Path); saved.AccessToken != "access3" || saved.RefreshToken != "refresh2" {
+		t.Errorf("saved token %+v, want access3 with refresh2 kept", saved)
+	}
+}
+
+func TestTwitterOAuth2RetryUnauthorized(t *testing.T) {
+	fake := &twitterOAuth2Server{
+		t:      t,
+		grant:  `{"access_token": "access2", "refresh_token": "refresh2", "expires_in": 7200}`,
+		access: "access2",
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	auth := newTwitterOAuth2(t, server, &TwitterToken{AccessToken: "revoked", RefreshToken: "refresh1", Expiry: time.Now().Add(time.Hour)})
+	client := NewTwitterClient(server.URL, auth)
+	if _, err := client.CreateTweet(context.Background(), "text"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.tweets != 2 || len(fake.refreshTokens) != 1 {
+		t.Errorf("sent %d tweets and %d refreshes, want 2 and 1", fake.tweets, len(fake.refreshTokens))
+	}
+
+	// A token that is rejected again is not retried a second time.
+	fake.access = "never"
+	fake.tweets, fake.refreshTokens = 0, nil
+	_, err := client.CreateTweet(context.Background(), "text")
+	if !errors.Is(err, ErrTwitterUnauthorized) {
+		t.Errorf("error = %v, want %v", err, ErrTwitterUnauthorized)
+	}
+	if fake.tweets != 2 || len(fake.refreshTokens) != 1 {
+		t.Errorf("sent %d tweets and %d refreshes, want 2 and 1", fake.tweets, len(fake.refreshTokens))
+	}
+}
+
+func TestTwitterOAuth2InvalidGrant(t *testing.T) {
+	fake := &twitterOAuth2Server{
+		t:      t,
+		grant:  `{"error": "invalid_grant", "error_description": "Value passed for the token was invalid."}`,
+		status: http.StatusBadRequest,
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	token := &TwitterToken{AccessToken: "access1", RefreshToken: "used", Expiry: time.Now().Add(-time.Minute).Round(time.Second)}
+	auth := newTwitterOAuth2(t, server, token)
+	_, err := NewTwitterClient(server.URL, auth).CreateTweet(context.Background(), "text")
+	if !errors.Is(err, ErrTwitterReauthorize) {
+		t.Fatalf("error = %v, want %v", err, ErrTwitterReauthorize)
+	}
+	if !strings.Contains(err.Error(), "twitter-auth") {
+		t.Errorf("error %q does not say to run twitter-auth", err)
+	}
+	if fake.tweets != 0 {
+		t.Errorf("sent %d tweets without a token, want none", fake.tweets)
+	}
+	if saved := readToken(t, auth.Store.Path); saved.RefreshToken != "used" || !saved.Expiry.Equal(token.Expiry) {
+		t.Errorf("saved token changed to %+v, want %+v", saved, token)
+	}
+}
+
+func TestTweetLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"Paxos", 5},
+		{"https://example.org/" + strings.Repeat("a", 200) + ".pdf", TwitterLinkLength},
+		{"Raft (PDF)\nhttps://raft.github.io/raft.pdf\n#DistributedSystems", 11 + TwitterLinkLength + 20},
+		{"see http://a.io.", 4 + TwitterLinkLength + 1},
+		{"Ünïcödé", 7},
+	}
+
+	for _, test := range tests {
+		if got := TweetLength(test.text); got != test.want {
+			t.Errorf("TweetLength(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestTwitterText(t *testing.T) {
+	long := strings.Repeat("Ünïcödé Consensus ", 30)
+	tests := []struct {
+		name  string
+		paper *Paper
+		tags  bool
+	}{
+		{"short", &Paper{
+			Name:  "Paxos Made Simple",
+			URL:   "https://lamport.azurewebsites.net/pubs/paxos-simple.pdf",
+			Kind:  KindPDF,
+			Topic: "distributed_systems",
+		}, true},
+		{"long links", &Paper{
+			Name:   "Raft",
+			URL:    "https://example.org/" + strings.Repeat("a", 400) + ".pdf",
+			Mirror: "https://example.org/" + strings.Repeat("b", 400) + ".pdf",
+			Form:   FormBoth,
+			Kind:   KindPDF,
+			Topic:  "distributed_systems",
+		}, true},
+		{"long name", &Paper{
+			Name:     long,
+			URL:      "https://example.org/paper.pdf",
+			Mirror:   "https://github.com/papers-we-love/papers-we-love/blob/master/distributed_systems/paper.pdf",
+			Form:     FormBoth,
+			Kind:     KindPDF,
+			Topic:    "distributed_systems/consensus",
+			Subtopic: "Paxos",
+		}, true},
+		{"long topic", &Paper{
+			Name:     "Raft",
+			URL:      "https://example.org/raft.pdf",
+			Kind:     KindPDF,
+			Topic:    strings.Repeat("topic_", 60),
+			Subtopic: strings.Repeat("sub_", 60),
+		}, false},
+	}
+
+	for _, test := range tests {
+		post := NewPost(test.paper)
+		text := TwitterText(post)
+		if n := TweetLength(text); n > TwitterMaxLength {
+			t.Errorf("%s: text is %d characters long, want at most %d", test.name, n, TwitterMaxLength)
+		}
+		if TweetLength(post.Text) <= TwitterMaxLength && text != post.Text {
+			t.Errorf("%s: text = %q, want it unchanged", test.name, text)
+		}
+		for _, link := range []string{test.paper.URL, test.paper.Mirror} {
+			if !strings.Contains(text, link) {
+				t.Errorf("%s: text %q lost the link %s", test.name, text, link)
+			}
+		}
+		if !strings.Contains(text, "("+string(test.paper.Kind)+")") {
+			t.Errorf("%s: text %q lost the paper kind", test.name, text)
+		}
+		if got := strings.Contains(text, "#"); got != test.tags {
+			t.Errorf("%s: text %q has hashtags %t, want %t", test.name, text, got, test.tags)
+		}
+	}
+
+	text := TwitterText(Post{Text: strings.Repeat("word ", 54) + "https://example.org/" + strings.Repeat("a", 100) + " tail"})
+	if n := TweetLength(text); n > TwitterMaxLength || !strings.HasSuffix(text, "…") {
+		t.Errorf("cut text %q is %d characters long, want at most %d ending in an ellipsis", text, n, TwitterMaxLength)
+	}
+	if strings.Contains(text, "https://") && !strings.Contains(text, "https://example.org/"+strings.Repeat("a", 100)) {
+		t.Errorf("cut text %q cuts through a link", text)
+	}
+}
+
+func TestTwitterPublishShortens(t *testing.T) {
+	var got string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		got = body.Text
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"data": {"id": "1", "text": "tweet"}}`)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	paper := &Paper{Name: strings.Repeat("Consensus ", 40), URL: "https://example.org/paper.pdf", Kind: KindPDF, Topic: "distributed_systems"}
+	publisher := &TwitterPublisher{Client: NewTwitterClient(server.URL, NewTwitterOAuth1("key", "secret", "token", "token secret"))}
+	if _, err := publisher.Publish(context.Background(), NewPost(paper)); err != nil {
+		t.Fatal(err)
+	}
+	if got != TwitterText(NewPost(paper)) || TweetLength(got) > TwitterMaxLength {
+		t.Errorf("tweeted %q, want the text shortened to fit", got)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// WebhookKind is the chat service a webhook posts to.
+type WebhookKind string
+
+const (
+	Slack      WebhookKind = "slack"
+	Discord    WebhookKind = "discord"
+	Mattermost WebhookKind = "mattermost"
+)
+
+// ParseWebhook splits a publisher name of the form kind or kind:destination
+// into the webhook kind and destination. It returns false if name is not a
+// webhook publisher.
+func ParseWebhook(name string) (kind WebhookKind, destination string, ok bool) {
+	parts := strings.SplitN(strings.ToLower(name), ":", 2)
+	switch k := WebhookKind(parts[0]); k {
+	case Slack, Discord, Mattermost:
+		if len(parts) == 2 {
+			return k, parts[1], true
+		}
+		return k, "", true
+	}
+
+	return "", "", false
+}
+
+// WebhookEnv returns the prefix of the environment variables configuring
+// the webhook publisher name, e.g. SLACK for slack and SLACK_TEAM for
+// slack:team.
+func WebhookEnv(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, name)
+}
+
+// WebhookPublisher posts messages to a Slack, Discord or Mattermost
+// incoming webhook. The webhook URL is a secret: it is never logged and is
+// left out of errors.
+type WebhookPublisher struct {
+	Kind WebhookKind
+
+	name   string
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher returns a WebhookPublisher named name posting to the
+// webhook at webhookURL.
+func NewWebhookPublisher(name string, kind WebhookKind, webhookURL string) *WebhookPublisher {
+	return &WebhookPublisher{
+		Kind:   kind,
+		name:   strings.ToLower(name),
+		url:    webhookURL,
+		client: &http.Client{},
+	}
+}
+
+func (w *WebhookPublisher) Name() string {
+	return w.name
+}
+
+// String returns the publisher's name, so printing it does not reveal the
+// webhook URL.
+func (w *WebhookPublisher) String() string {
+	return w.name
+}
+
+// Publish posts the paper to the webhook. Only Discord returns the ID of
+// the message posted.
+func (w *WebhookPublisher) Publish(ctx context.Context, post Post) (*Published, error) {
+	var message interface{}
+	endpoint := w.url
+	switch w.Kind {
+	case Slack:
+		message = slackMessage(post)
+	case Discord:
+		message = discordMessage(post)
+		endpoint = withQuery(endpoint, "wait", "true")
+	case Mattermost:
+		message = mattermostMessage(post)
+	default:
+		return nil, fmt.Errorf("unknown webhook kind %q", w.Kind)
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// The error of a failed request quotes the URL.
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("posting to webhook: %s", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if text := strings.TrimSpace(string(data)); text != "" && utf8.ValidString(text) && len(text) < 512 {
+			return nil, fmt.Errorf("posting to webhook: %s: %s", resp.Status, text)
+		}
+		return nil, fmt.Errorf("posting to webhook: %s", resp.Status)
+	}
+
+	published := &Published{}
+	if w.Kind == Discord {
+		var msg struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &msg); err == nil {
+			published.ID = msg.ID
+		}
+	}
+
+	return published, nil
+}
+
+// withQuery returns rawurl with the query parameter key set to value.
+func withQuery(rawurl, key, value string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// PaperTopic returns the paper's topic and subtopic, e.g.
+// "DistributedSystems/Consensus, Paxos".
+func PaperTopic(paper *Paper) string {
+	if paper.Subtopic == "" || strings.HasSuffix(paper.Topic, "/"+paper.Subtopic) || paper.Topic == paper.Subtopic {
+		return paper.Topic
+	}
+	if paper.Topic == "" {
+		return paper.Subtopic
+	}
+
+	return paper.Topic + ", " + paper.Subtopic
+}
+
+// truncate shortens s to at most n runes, ending it with an ellipsis if it
+// was cut.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackButton struct {
+	Type string    `json:"type"`
+	Text slackText `json:"text"`
+	URL  string    `json:"url"`
+}
+
+type slackBlock struct {
+	Type     string        `json:"type"`
+	Text     *slackText    `json:"text,omitempty"`
+	Elements []interface{} `json:"elements,omitempty"`
+}
+
+// slackEscaper escapes the characters Slack's mrkdwn gives a meaning.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackTruncate escapes s for mrkdwn and shortens it to at most n
+// characters, ending it with an ellipsis if it was cut. It never cuts
+// through an escaped character.
+func slackTruncate(s string, n int) string {
+	escaped := slackEscaper.Replace(s)
+	if utf8.RuneCountInString(escaped) <= n {
+		return escaped
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		e := slackEscaper.Replace(string(r))
+		if width+utf8.RuneCountInString(e) > n-1 {
+			break
+		}
+		b.WriteString(e)
+		width += utf8.RuneCountInString(e)
+	}
+
+	return b.String() + "…"
+}
+
+// slackMessage returns the Block Kit message of post: the paper's title and
+// byline, its topic and a button opening the paper.
+func slackMessage(post Post) interface{} {
+	paper := post.Paper
+
+	rest := fmt.Sprintf(" (%s)", paper.Kind)
+	if byline := PaperByline(paper); byline != "" {
+		rest += "\n" + slackTruncate(byline, 1000)
+	}
+	if paper.Mirror != "" {
+		rest += fmt.Sprintf("\n<%s|Mirror>", paper.Mirror)
+	}
+
+	// The section's text is limited to 3000 characters. Shorten the name
+	// rather than the whole text, so the cut never falls inside a link.
+	room := 3000 - utf8.RuneCountInString(fmt.Sprintf("*<%s|>*", paper.URL)+rest)
+	text := fmt.Sprintf("*<%s|%s>*", paper.URL, slackTruncate(paper.Name, room)) + rest
+
+	blocks := []slackBlock{{
+		Type: "section",
+		Text: &slackText{Type: "mrkdwn", Text: text},
+	}}
+	if topic := PaperTopic(paper); topic != "" {
+		blocks = append(blocks, slackBlock{
+			Type:     "context",
+			Elements: []interface{}{&slackText{Type: "mrkdwn", Text: slackEscaper.Replace(topic)}},
+		})
+	}
+	blocks = append(blocks, slackBlock{
+		Type: "actions",
+		Elements: []interface{}{&slackButton{
+			Type: "button",
+			Text: slackText{Type: "plain_text", Text: "Read the paper"},
+			URL:  paper.URL,
+		}},
+	})
+
+	return &struct {
+		Text   string       `json:"text"`
+		Blocks []slackBlock `json:"blocks"`
+	}{post.Text, blocks}
+}
+
+// discordMessage returns the message of post: an embed with the paper's
+// title and link, its byline and its topic in the footer.
+func discordMessage(post Post) interface{} {
+	paper := post.Paper
+
+	type footer struct {
+		Text string `json:"text"`
+	}
+	type embed struct {
+		Title       string  `json:"title"`
+		URL         string  `json:"url"`
+		Description string  `json:"description,omitempty"`
+		Footer      *footer `json:"footer,omitempty"`
+	}
+
+	var description []string
+	if byline := PaperByline(paper); byline != "" {
+		description = append(description, byline)
+	}
+	if paper.Mirror != "" {
+		description = append(description, "[Mirror]("+paper.Mirror+")")
+	}
+
+	e := embed{
+		Title:       truncate(fmt.Sprintf("%s (%s)", paper.Name, paper.Kind), 256),
+		URL:         paper.URL,
+		Description: strings.Join(description, "\n"),
+	}
+	if topic := PaperTopic(paper); topic != "" {
+		e.Footer = &footer{Text: truncate(topic, 2048)}
+	}
+
+	return &struct {
+		Embeds []embed `json:"embeds"`
+	}{[]embed{e}}
+}
+
+// mattermostMessage returns the message of post: an attachment with the
+// paper's title and link, its byline and its topic in the footer.
+func mattermostMessage(post Post) interface{} {
+	paper := post.Paper
+
+	type attachment struct {
+		Fallback  string `json:"fallback"`
+		Title     string `json:"title"`
+		TitleLink string `json:"title_link"`
+		Text      string `json:"text,omitempty"`
+		Footer    string `json:"footer,omitempty"`
+	}
+
+	var text []string
+	if byline := PaperByline(paper); byline != "" {
+		text = append(text, byline)
+	}
+	if paper.Mirror != "" {
+		text = append(text, "[Mirror]("+paper.Mirror+")")
+	}
+
+	return &struct {
+		Attachments []attachment `json:"attachments"`
+	}{[]attachment{{
+		Fallback:  post.Text,
+		Title:     fmt.Sprintf("%s (%s)", paper.Name, paper.Kind),
+		TitleLink: paper.URL,
+		Text:      strings.Join(text, "\n"),
+		Footer:    PaperTopic(paper),
+	}}}
+}
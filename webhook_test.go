@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testWebhookPaper() *Paper {
+	return &Paper{
+		Name:     "Paxos Made Simple",
+		URL:      "https://lamport.azurewebsites.net/pubs/paxos-simple.pdf",
+		Mirror:   "https://example.org/mirror/paxos-simple.pdf",
+		Kind:     KindPDF,
+		Authors:  []string{"Leslie Lamport"},
+		Year:     2001,
+		Topic:    "DistributedSystems",
+		Subtopic: "Consensus",
+	}
+}
+
+// jsonText returns s as a JSON string.
+func jsonText(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func TestWebhookPublish(t *testing.T) {
+	post := NewPost(testWebhookPaper())
+	tests := []struct {
+		kind  WebhookKind
+		query string
+		reply string
+		id    string
+		want  string
+	}{
+		{Slack, "", "ok", "", `{
+			"text": ` + jsonText(post.Text) + `,
+			"blocks": [
+				{"type": "section", "text": {"type": "mrkdwn", "text": "*<https://lamport.azurewebsites.net/pubs/paxos-simple.pdf|Paxos Made Simple>* (PDF)\nLeslie Lamport, 2001\n<https://example.org/mirror/paxos-simple.pdf|Mirror>"}},
+				{"type": "context", "elements": [{"type": "mrkdwn", "text": "DistributedSystems, Consensus"}]},
+				{"type": "actions", "elements": [{"type": "button", "text": {"type": "plain_text", "text": "Read the paper"}, "url": "https://lamport.azurewebsites.net/pubs/paxos-simple.pdf"}]}
+			]
+		}`},
+		{Discord, "wait=true", `{"id": "1234"}`, "1234", `{
+			"embeds": [{
+				"title": "Paxos Made Simple (PDF)",
+				"url": "https://lamport.azurewebsites.net/pubs/paxos-simple.pdf",
+				"description": "Leslie Lamport, 2001\n[Mirror](https://example.org/mirror/paxos-simple.pdf)",
+				"footer": {"text": "DistributedSystems, Consensus"}
+			}]
+		}`},
+		{Mattermost, "", "ok", "", `{
+			"attachments": [{
+				"fallback": ` + jsonText(post.Text) + `,
+				"title": "Paxos Made Simple (PDF)",
+				"title_link": "https://lamport.azurewebsites.net/pubs/paxos-simple.pdf",
+				"text": "Leslie Lamport, 2001\n[Mirror](https://example.org/mirror/paxos-simple.pdf)",
+				"footer": "DistributedSystems, Consensus"
+			}]
+		}`},
+	}
+
+	for _, test := range tests {
+		var body []byte
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" || r.URL.Path != "/hooks/secret" || r.URL.RawQuery != test.query {
+				t.Errorf("%s: got %s %s, want POST /hooks/secret?%s", test.kind, r.Method, r.URL, test.query)
+			}
+			if got := r.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("%s: Content-Type = %q, want application/json", test.kind, got)
+			}
+			body, _ = ioutil.ReadAll(r.Body)
+			fmt.Fprint(w, test.reply)
+		})
+		server := httptest.NewServer(handler)
+
+		w := NewWebhookPublisher(string(test.kind), test.kind, server.URL+"/hooks/secret")
+		published, err := w.Publish(context.Background(), post)
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.kind, err)
+			continue
+		}
+		if published.ID != test.id {
+			t.Errorf("%s: ID = %q, want %q", test.kind, published.ID, test.id)
+		}
+
+		var got, want interface{}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("%s: %v", test.kind, err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: posted\n%s\nwant\n%s", test.kind, body, test.want)
+		}
+	}
+}
+
+func TestWebhookPublishError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "no_service")
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// The closed server refuses the connection.
+	closed := httptest.NewServer(handler)
+	closed.Close()
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{server.URL + "/hooks/T000/B000/secret", "404 Not Found: no_service"},
+		{closed.URL + "/hooks/T000/B000/secret", "posting to webhook"},
+		{"http://[::1/hooks/T000/B000/secret", "invalid webhook URL"},
+	}
+
+	for _, test := range tests {
+		for _, kind := range []WebhookKind{Slack, Discord, Mattermost} {
+			w := NewWebhookPublisher(string(kind), kind, test.url)
+			_, err := w.Publish(context.Background(), NewPost(testWebhookPaper()))
+			if err == nil {
+				t.Errorf("%s: Publish(%s) succeeded, want an error", kind, test.url)
+				continue
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("%s: Publish(%s) error = %v, want %q", kind, test.url, err, test.want)
+			}
+			if strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), "/hooks/") {
+				t.Errorf("%s: Publish(%s) error = %v, reveals the webhook URL", kind, test.url, err)
+			}
+		}
+	}
+}
+
+func TestSlackTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"Paxos", 5, "Paxos"},
+		{"Paxos Made Simple", 6, "Paxos…"},
+		{"A & B", 5, "A …"},
+		{"A & B", 9, "A &amp; B"},
+		{"<Paxos>", 8, "&lt;Pax…"},
+		{"Paxos", 0, "…"},
+	}
+
+	for _, test := range tests {
+		if got := slackTruncate(test.s, test.n); got != test.want {
+			t.Errorf("slackTruncate(%q, %d) = %q, want %q", test.s, test.n, got, test.want)
+		}
+	}
+}
+
+func TestSlackMessageLongName(t *testing.T) {
+	paper := testWebhookPaper()
+	paper.Name = strings.Repeat("Paxos & Raft ", 300)
+
+	data, err := json.Marshal(slackMessage(NewPost(paper)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message struct {
+		Blocks []slackBlock
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatal(err)
+	}
+	text := message.Blocks[0].Text.Text
+
+	if n := len([]rune(text)); n > 3000 {
+		t.Errorf("section text has %d characters, want at most 3000", n)
+	}
+	if !strings.HasPrefix(text, "*<"+paper.URL+"|Paxos &amp; Raft ") || !strings.Contains(text, "…>* (PDF)\nLeslie Lamport, 2001\n<"+paper.Mirror+"|Mirror>") {
+		t.Errorf("section text = %q, want the name shortened inside the link", text)
+	}
+}